@@ -101,3 +101,80 @@ func (sm Softmax) Derivative(m *mat.Dense) *mat.Dense {
 
 	return tmp
 }
+
+type Tanh struct{}
+
+func NewTanh() Activation {
+	return &Tanh{}
+}
+
+// Activation computes (e^x - e^-x) / (e^x + e^-x) for a vector
+func (t Tanh) Activation(m *mat.Dense) *mat.Dense {
+	if m.RawMatrix().Cols != 1 {
+		log.Fatal("input with one column is expected")
+	}
+
+	vec := m.ColView(0)
+	tmp := mat.NewDense(vec.Len(), 1, nil)
+
+	tmp.Apply(func(_, _ int, v float64) float64 {
+		return math.Tanh(v)
+	}, vec)
+
+	return tmp
+}
+
+// Derivative computes 1 - tanh(x)² which is the derivative of the hyperbolic
+// tangent. As with the sigmoid function, it is expressed through the output of
+// the activation function
+func (t Tanh) Derivative(m *mat.Dense) *mat.Dense {
+	if m.RawMatrix().Cols != 1 {
+		log.Fatal("input with one column is expected")
+	}
+
+	vec := m.ColView(0)
+	tmp := mat.NewDense(vec.Len(), 1, nil)
+
+	tmp.Apply(func(_, _ int, v float64) float64 {
+		return 1.0 - v*v
+	}, vec)
+
+	return tmp
+}
+
+// sigmoid computes 1 / (1 + e^-v) for a scalar
+func sigmoid(v float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-v))
+}
+
+type Linear struct{}
+
+// NewLinear creates the identity activation function, which leaves outputs of
+// a layer as they are. It is meant for output layers of regression models
+func NewLinear() Activation {
+	return &Linear{}
+}
+
+// Activation returns a copy of a vector
+func (l Linear) Activation(m *mat.Dense) *mat.Dense {
+	if m.RawMatrix().Cols != 1 {
+		log.Fatal("input with one column is expected")
+	}
+
+	return mat.DenseCopyOf(m)
+}
+
+// Derivative returns a vector of ones, as the derivative of f(x) = x is 1
+func (l Linear) Derivative(m *mat.Dense) *mat.Dense {
+	if m.RawMatrix().Cols != 1 {
+		log.Fatal("input with one column is expected")
+	}
+
+	tmp := mat.NewDense(m.RawMatrix().Rows, 1, nil)
+
+	tmp.Apply(func(_, _ int, _ float64) float64 {
+		return 1
+	}, tmp)
+
+	return tmp
+}
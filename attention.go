@@ -0,0 +1,354 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+type MultiHeadAttention struct {
+	heads   int
+	causal  bool
+	input   BackpropagationLayer
+	output  BackpropagationLayer
+	weights *mat.Dense
+	biases  *mat.Dense
+}
+
+// NewMultiHeadAttention creates a self-attention layer proposed by Vaswani et
+// al. (https://doi.org/10.48550/arXiv.1706.03762). It receives a sequence (a
+// dimensions x steps matrix) and returns a sequence of the same shape. The
+// dimensions are split evenly between heads. With causal set, every step
+// attends only to itself and previous steps.
+//
+// Weights of query, key, value and output projections are packed into a
+// single matrix of 4 * dimensions rows (Wq, Wk, Wv, Wo) and dimensions columns.
+func NewMultiHeadAttention(heads int, causal bool) BackpropagationLayer {
+	return &MultiHeadAttention{
+		heads:  heads,
+		causal: causal,
+	}
+}
+
+func (l *MultiHeadAttention) Rows() int {
+	return l.input.Rows()
+}
+
+func (l *MultiHeadAttention) Cols() int {
+	return l.input.Rows()
+}
+
+func (l *MultiHeadAttention) IsInput() bool {
+	return false
+}
+
+func (l *MultiHeadAttention) IsOutput() bool {
+	return false
+}
+
+func (l *MultiHeadAttention) Weights() *mat.Dense {
+	return l.weights
+}
+
+func (l *MultiHeadAttention) Biases() *mat.Dense {
+	return l.biases
+}
+
+func (l *MultiHeadAttention) SetWeights(w *mat.Dense) {
+	l.weights = w
+}
+
+func (l *MultiHeadAttention) SetBiases(b *mat.Dense) {
+	l.biases = b
+}
+
+func (l *MultiHeadAttention) SetInput(input BackpropagationLayer) {
+	l.input = input
+}
+
+func (l *MultiHeadAttention) SetOutput(output BackpropagationLayer) {
+	l.output = output
+}
+
+// InitParameters initializes packed projections. Weights are scaled by 1/√d,
+// otherwise dot products of queries and keys are large enough to saturate the
+// softmax function from the very beginning.
+func (l *MultiHeadAttention) InitParameters(wi WeightInitializer) {
+	d := l.input.Rows()
+
+	if l.heads <= 0 || d%l.heads != 0 {
+		log.Fatalln(fmt.Errorf("%d dimensions cannot be split between %d heads", d, l.heads))
+	}
+
+	l.weights = wi.InitWeights(4*d, d)
+	l.weights.Scale(1/math.Sqrt(float64(d)), l.weights)
+	l.biases = mat.NewDense(4*d, 1, nil)
+}
+
+// Feedforward projects every step of x into queries, keys and values, then
+// every head computes softmax(QᵀK / √dk) and mixes values with these weights.
+// Outputs of all heads are concatenated and projected once again. Projections,
+// attention weights and concatenated outputs of heads are stored in the
+// activations stack for backpropagation.
+func (l *MultiHeadAttention) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	d, steps := x.Dims()
+	dk := d / l.heads
+	scale := 1 / math.Sqrt(float64(dk))
+
+	// [Q; K; V] = [Wq; Wk; Wv]x + [bq; bk; bv]
+	qkv := mat.NewDense(3*d, steps, nil)
+	qkv.Mul(l.weights.Slice(0, 3*d, 0, d), x)
+	addBiases(qkv, l.biases.Slice(0, 3*d, 0, 1))
+
+	attention := mat.NewDense(l.heads*steps, steps, nil)
+	heads := mat.NewDense(d, steps, nil)
+
+	for h := range l.heads {
+		q := qkv.Slice(h*dk, (h+1)*dk, 0, steps)
+		k := qkv.Slice(d+h*dk, d+(h+1)*dk, 0, steps)
+		v := qkv.Slice(2*d+h*dk, 2*d+(h+1)*dk, 0, steps)
+
+		// Row i holds weights of all steps for step i
+		a := attention.Slice(h*steps, (h+1)*steps, 0, steps).(*mat.Dense)
+		a.Mul(q.T(), k)
+		a.Scale(scale, a)
+
+		for i := range steps {
+			if l.causal {
+				for j := i + 1; j < steps; j++ {
+					a.Set(i, j, math.Inf(-1))
+				}
+			}
+
+			softmax(a.RawRowView(i))
+		}
+
+		// V * Aᵀ
+		heads.Slice(h*dk, (h+1)*dk, 0, steps).(*mat.Dense).Mul(v, a.T())
+	}
+
+	y := mat.NewDense(d, steps, nil)
+	y.Mul(l.weights.Slice(3*d, 4*d, 0, d), heads)
+	addBiases(y, l.biases.Slice(3*d, 4*d, 0, 1))
+
+	if activations != nil {
+		activations.Push(qkv)
+		activations.Push(attention)
+		activations.Push(heads)
+		activations.Push(y)
+	}
+
+	if l.output != nil {
+		return l.output.Feedforward(y, activations)
+	}
+
+	return y
+}
+
+// Backpropagation passes error back through the output projection, attention
+// weights of every head (including the softmax function applied to them) and
+// query, key and value projections.
+func (l *MultiHeadAttention) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop()
+	heads := activations.Pop()
+	attention := activations.Pop()
+	qkv := activations.Pop()
+	x := activations.Peek()
+
+	d, steps := x.Dims()
+	dk := d / l.heads
+	scale := 1 / math.Sqrt(float64(dk))
+
+	deltaW := mat.NewDense(4*d, d, nil)
+	deltaB := mat.NewDense(4*d, 1, nil)
+
+	// Output projection: delta * headsᵀ
+	deltaW.Slice(3*d, 4*d, 0, d).(*mat.Dense).Mul(delta, heads.T())
+	deltaB.Slice(3*d, 4*d, 0, 1).(*mat.Dense).Copy(rowSums(delta))
+
+	dHeads := mat.NewDense(d, steps, nil)
+	dHeads.Mul(l.weights.Slice(3*d, 4*d, 0, d).T(), delta)
+
+	dqkv := mat.NewDense(3*d, steps, nil)
+
+	for h := range l.heads {
+		q := qkv.Slice(h*dk, (h+1)*dk, 0, steps)
+		k := qkv.Slice(d+h*dk, d+(h+1)*dk, 0, steps)
+		v := qkv.Slice(2*d+h*dk, 2*d+(h+1)*dk, 0, steps)
+		a := attention.Slice(h*steps, (h+1)*steps, 0, steps).(*mat.Dense)
+		dh := dHeads.Slice(h*dk, (h+1)*dk, 0, steps)
+
+		// dV = dHeads * A
+		dqkv.Slice(2*d+h*dk, 2*d+(h+1)*dk, 0, steps).(*mat.Dense).Mul(dh, a)
+
+		// dA = dHeadsᵀ * V
+		ds := mat.NewDense(steps, steps, nil)
+		ds.Mul(dh.T(), v)
+
+		// Derivative of softmax for every row: a ⊙ (da - Σ(a ⊙ da)). Masked
+		// steps have zero weights, so they receive no error
+		for i := range steps {
+			ar, dr := a.RawRowView(i), ds.RawRowView(i)
+			sum := float64(0)
+
+			for j := range steps {
+				sum += ar[j] * dr[j]
+			}
+
+			for j := range steps {
+				dr[j] = ar[j] * (dr[j] - sum) * scale
+			}
+		}
+
+		// dQ = K * dSᵀ, dK = Q * dS
+		dqkv.Slice(h*dk, (h+1)*dk, 0, steps).(*mat.Dense).Mul(k, ds.T())
+		dqkv.Slice(d+h*dk, d+(h+1)*dk, 0, steps).(*mat.Dense).Mul(q, ds)
+	}
+
+	// Query, key and value projections: dQKV * xᵀ
+	deltaW.Slice(0, 3*d, 0, d).(*mat.Dense).Mul(dqkv, x.T())
+	deltaB.Slice(0, 3*d, 0, 1).(*mat.Dense).Copy(rowSums(dqkv))
+
+	// Last layers go first to the stack to be on its bottom after recursion
+	deltaWs.Push(deltaW)
+	deltaBs.Push(deltaB)
+
+	if l.input != nil {
+		var prev *mat.Dense
+
+		if !l.input.IsInput() {
+			prev = mat.NewDense(d, steps, nil)
+			prev.Mul(l.weights.Slice(0, 3*d, 0, d).T(), dqkv)
+		}
+
+		l.input.Backpropagation(prev, activations, deltaWs, deltaBs)
+	}
+}
+
+type PositionalEncoding struct {
+	input  BackpropagationLayer
+	output BackpropagationLayer
+}
+
+// NewPositionalEncoding creates a layer adding sinusoidal positional encoding
+// proposed by Vaswani et al. (https://doi.org/10.48550/arXiv.1706.03762) to a
+// sequence, as attention itself knows nothing about the order of steps. The
+// layer has no weights.
+func NewPositionalEncoding() BackpropagationLayer {
+	return &PositionalEncoding{}
+}
+
+func (l *PositionalEncoding) Rows() int {
+	return l.input.Rows()
+}
+
+func (l *PositionalEncoding) Cols() int {
+	return l.input.Rows()
+}
+
+func (l *PositionalEncoding) IsInput() bool {
+	return false
+}
+
+func (l *PositionalEncoding) IsOutput() bool {
+	return false
+}
+
+func (l *PositionalEncoding) Weights() *mat.Dense {
+	return nil
+}
+
+func (l *PositionalEncoding) Biases() *mat.Dense {
+	return nil
+}
+
+func (l *PositionalEncoding) SetWeights(_ *mat.Dense) {
+}
+
+func (l *PositionalEncoding) SetBiases(_ *mat.Dense) {
+}
+
+func (l *PositionalEncoding) SetInput(input BackpropagationLayer) {
+	l.input = input
+}
+
+func (l *PositionalEncoding) SetOutput(output BackpropagationLayer) {
+	l.output = output
+}
+
+// InitParameters does nothing, as there are no parameters to initialize
+func (l *PositionalEncoding) InitParameters(_ WeightInitializer) {
+}
+
+// Feedforward adds sin(t / 10000^(2i/d)) to even dimensions and cos(t /
+// 10000^(2i/d)) to odd dimensions of every step t of a sequence
+func (l *PositionalEncoding) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	d, steps := x.Dims()
+	y := mat.NewDense(d, steps, nil)
+
+	y.Apply(func(i, t int, v float64) float64 {
+		angle := float64(t) / math.Pow(10000, float64(i-i%2)/float64(d))
+
+		if i%2 == 0 {
+			return v + math.Sin(angle)
+		}
+
+		return v + math.Cos(angle)
+	}, x)
+
+	if activations != nil {
+		activations.Push(y)
+	}
+
+	if l.output != nil {
+		return l.output.Feedforward(y, activations)
+	}
+
+	return y
+}
+
+// Backpropagation passes error to the previous layer as is, since positions
+// are added as constants
+func (l *PositionalEncoding) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop()
+
+	if l.input != nil {
+		l.input.Backpropagation(delta, activations, deltaWs, deltaBs)
+	}
+}
+
+// addBiases adds a column of biases to every column of m
+func addBiases(m *mat.Dense, biases mat.Matrix) {
+	m.Apply(func(i, _ int, v float64) float64 {
+		return v + biases.At(i, 0)
+	}, m)
+}
+
+// rowSums returns a column with sums of every row of m
+func rowSums(m *mat.Dense) *mat.Dense {
+	r, _ := m.Dims()
+	sum := mat.NewDense(r, 1, nil)
+
+	for i := range r {
+		sum.Set(i, 0, floats.Sum(m.RawRowView(i)))
+	}
+
+	return sum
+}
+
+// softmax computes exp(x) / sum(exp(x)) in place. The maximum value is
+// subtracted first to avoid overflows, which also allows -Inf for masking
+func softmax(x []float64) {
+	maximum := floats.Max(x)
+	sum := float64(0)
+
+	for i := range x {
+		x[i] = math.Exp(x[i] - maximum)
+		sum += x[i]
+	}
+
+	floats.Scale(1/sum, x)
+}
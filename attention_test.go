@@ -0,0 +1,41 @@
+package deeper
+
+import (
+	"testing"
+)
+
+func TestAttentionGradients(t *testing.T) {
+	for _, causal := range []bool{false, true} {
+		n := NewNetwork()
+		n.AddLayer(NewInputLayer(4))
+		n.AddLayer(NewPositionalEncoding())
+		n.AddLayer(NewMultiHeadAttention(2, causal))
+		n.AddLayer(NewMultiHeadAttention(4, causal))
+		n.AddLayer(NewGlobalAveragePooling())
+		n.AddLayer(NewOutputLayer(3, identity{}))
+		gradCheck(t, n, rnd(4, 5), rnd(3, 1))
+	}
+}
+
+func TestAttentionSequenceGradients(t *testing.T) {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(4))
+	n.AddLayer(NewMultiHeadAttention(2, true))
+	gradCheck(t, n, rnd(4, 5), rnd(4, 5))
+}
+
+func TestAttentionExport(t *testing.T) {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(1))
+	n.AddLayer(NewEmbedding(10, 8))
+	n.AddLayer(NewPositionalEncoding())
+	n.AddLayer(NewMultiHeadAttention(2, false))
+	n.AddLayer(NewGlobalAveragePooling())
+	n.AddLayer(NewOutputLayer(2, NewSoftmax()))
+	n.SetOptimizer(NewSGD(0.9, true))
+	n.SetLossFunction(NewCategoricalCrossEntropy(ReductionMean))
+	n.SetVerbosity(VerbosityQuiet)
+	tx, ty := tokenData(200)
+	n.Fit(FitOptions{TrainX: tx, TrainY: ty, ValX: tx, ValY: ty, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+	assertSamePredictions(t, n, roundTrip(t, n), tx)
+}
@@ -3,16 +3,110 @@ package deeper
 import (
 	"fmt"
 	"log"
+	"maps"
+	"math"
 	"os"
+	"slices"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 type Callback interface {
 	AfterEpoch(n *Network, epoch int, ev Evaluation) bool
 }
 
+const (
+	// ModeAuto minimizes losses and errors (names containing "loss", "rmse" or
+	// "mae") and maximizes everything else
+	ModeAuto = iota
+	ModeMin
+	ModeMax
+)
+
+// Monitor describes a quantity watched by callbacks
+type Monitor struct {
+	// Metric is the name of the quantity in the epoch log (see
+	// Evaluation.Metric), "val_acc" by default
+	Metric string
+	// Mode tells whether the quantity is minimized or maximized
+	Mode int
+	// MinDelta is the smallest change of the quantity that counts as an
+	// improvement
+	MinDelta float64
+}
+
+// monitor tracks the best value of a monitored quantity
+type monitor struct {
+	Monitor
+	best float64
+	seen bool
+}
+
+func newMonitor(m Monitor) *monitor {
+	if m.Metric == "" {
+		m.Metric = "val_acc"
+	}
+
+	if m.Mode == ModeAuto {
+		m.Mode = ModeMax
+
+		for _, s := range []string{"loss", "rmse", "mae"} {
+			if strings.Contains(m.Metric, s) {
+				m.Mode = ModeMin
+			}
+		}
+	}
+
+	return &monitor{Monitor: m}
+}
+
+// value returns the monitored quantity of an evaluation
+func (m *monitor) value(ev Evaluation) float64 {
+	v, ok := ev.Metric(m.Metric)
+	if !ok {
+		log.Fatalln(fmt.Errorf("monitored metric %q is unknown, known metrics are %v", m.Metric, slices.Sorted(maps.Keys(ev.Metrics))))
+	}
+
+	return v
+}
+
+// better tells whether v is better than the best value by more than MinDelta
+func (m *monitor) better(v float64) bool {
+	if !m.seen {
+		return !math.IsNaN(v)
+	}
+
+	if m.Mode == ModeMin {
+		return v < m.best-m.MinDelta
+	}
+
+	return v > m.best+m.MinDelta
+}
+
+// update remembers v if it is an improvement, which is reported
+func (m *monitor) update(v float64) bool {
+	if !m.better(v) {
+		return false
+	}
+
+	m.best, m.seen = v, true
+
+	return true
+}
+
+type SaveBestOptions struct {
+	Monitor Monitor
+	// Threshold is the value the monitored quantity must exceed (or fall below
+	// when minimized) before models are saved, if HasThreshold is set
+	Threshold    float64
+	HasThreshold bool
+}
+
 type SaveBest struct {
-	bestAccuracy float32
-	threshold    float32
+	monitor      *monitor
+	threshold    float64
+	hasThreshold bool
 	saver        Exporter
 }
 
@@ -21,25 +115,40 @@ type SaveBest struct {
 // training sessions and exports models only when their Accuracy is higher than
 // previous best value in that session.
 func NewSaveBest(saver Exporter, threshold float32) Callback {
+	return NewSaveBestWithOptions(saver, SaveBestOptions{Threshold: float64(threshold), HasThreshold: true})
+}
+
+// NewSaveBestWithOptions exports models through the Exporter interface every
+// time the monitored quantity improves and passes the threshold
+func NewSaveBestWithOptions(saver Exporter, o SaveBestOptions) Callback {
 	return &SaveBest{
-		threshold: threshold,
-		saver:     saver,
+		monitor:      newMonitor(o.Monitor),
+		threshold:    o.Threshold,
+		hasThreshold: o.HasThreshold,
+		saver:        saver,
 	}
 }
 
 func (sb *SaveBest) AfterEpoch(n *Network, _ int, ev Evaluation) bool {
-	if ev.Accuracy > sb.threshold && ev.Accuracy > sb.bestAccuracy {
-		sb.bestAccuracy = ev.Accuracy
-		sb.doSaveBest(n, ev)
+	v := sb.monitor.value(ev)
+
+	if sb.hasThreshold {
+		if sb.monitor.Mode == ModeMin && v >= sb.threshold || sb.monitor.Mode == ModeMax && v <= sb.threshold {
+			return true
+		}
+	}
+
+	if sb.monitor.update(v) {
+		sb.doSaveBest(n, v)
 	}
 
 	return true
 }
 
-func (sb *SaveBest) doSaveBest(n *Network, e Evaluation) {
-	fp, err := os.OpenFile(sb.getFilename(e), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+func (sb *SaveBest) doSaveBest(n *Network, v float64) {
+	fp, err := os.OpenFile(sb.getFilename(v), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Fatalln(fmt.Errorf("failed to open file %s: %w", sb.getFilename(e), err))
+		log.Fatalln(fmt.Errorf("failed to open file %s: %w", sb.getFilename(v), err))
 	}
 	defer fp.Close()
 
@@ -48,30 +157,255 @@ func (sb *SaveBest) doSaveBest(n *Network, e Evaluation) {
 	}
 }
 
-func (sb *SaveBest) getFilename(e Evaluation) string {
-	return fmt.Sprintf("model-%.4f.json", e.Accuracy)
+func (sb *SaveBest) getFilename(v float64) string {
+	return fmt.Sprintf("model-%.4f.json", v)
+}
+
+type EarlyStoppingOptions struct {
+	Monitor Monitor
+	// WaitEpochs is the number of epochs without improvement after which
+	// training stops
+	WaitEpochs int
+	// RestoreBestWeights makes the network return to parameters of the best
+	// epoch when training stops, whether early or after the last epoch
+	RestoreBestWeights bool
 }
 
 type EarlyStopping struct {
-	bestAccuracy float32
-	bestEpoch    int
-	waitEpochs   int
+	monitor     *monitor
+	bestEpoch   int
+	waitEpochs  int
+	restoreBest bool
+	// waitFirst checks the wait before the epoch's result is counted, as
+	// NewEarlyStopping always did
+	waitFirst bool
+	weights   []*mat.Dense
+	biases    []*mat.Dense
 }
 
 // NewEarlyStopping creates a Callback that may interrupt training process
-// when we have not seen any improvements in Accuracy for waitEpochs epochs
+// when we have not seen any improvements in Accuracy for waitEpochs epochs.
+// The wait is checked before the result of the epoch is counted, so that an
+// improvement in the last epoch of the wait does not keep training going
 func NewEarlyStopping(waitEpochs int) Callback {
-	return &EarlyStopping{waitEpochs: waitEpochs}
+	es := NewEarlyStoppingWithOptions(EarlyStoppingOptions{WaitEpochs: waitEpochs}).(*EarlyStopping)
+	es.waitFirst = true
+
+	return es
+}
+
+// NewEarlyStoppingWithOptions creates a Callback that interrupts training when
+// the monitored quantity has not improved for WaitEpochs epochs. With
+// RestoreBestWeights set, parameters of the best epoch are kept in memory and
+// put back into the network when training stops or runs out of epochs. Unlike
+// NewEarlyStopping, the
+// result of the epoch is counted before the wait is checked.
+func NewEarlyStoppingWithOptions(o EarlyStoppingOptions) Callback {
+	return &EarlyStopping{
+		monitor:     newMonitor(o.Monitor),
+		waitEpochs:  o.WaitEpochs,
+		restoreBest: o.RestoreBestWeights,
+	}
 }
 
 func (es *EarlyStopping) AfterEpoch(n *Network, epoch int, ev Evaluation) bool {
-	if epoch-es.bestEpoch >= es.waitEpochs {
+	if es.waitFirst && epoch-es.bestEpoch >= es.waitEpochs {
 		return false
 	}
 
-	if ev.Accuracy > es.bestAccuracy {
-		es.bestAccuracy = ev.Accuracy
+	if es.monitor.update(es.monitor.value(ev)) {
 		es.bestEpoch = epoch
+
+		if es.restoreBest {
+			es.remember(n)
+		}
+	}
+
+	if !es.waitFirst && epoch-es.bestEpoch >= es.waitEpochs {
+		if es.restoreBest && es.weights != nil {
+			es.restore(n)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// OnTrainEnd puts parameters of the best epoch back into the network, so that
+// they are restored even when training is not stopped early
+func (es *EarlyStopping) OnTrainEnd(n *Network, _ Evaluation) {
+	if es.restoreBest && es.weights != nil {
+		es.restore(n)
+	}
+}
+
+// remember copies parameters of the network
+func (es *EarlyStopping) remember(n *Network) {
+	layers := n.trainable()
+	es.weights = make([]*mat.Dense, len(layers))
+	es.biases = make([]*mat.Dense, len(layers))
+
+	for i, l := range layers {
+		es.weights[i] = mat.DenseCopyOf(l.Weights())
+
+		if l.Biases() != nil {
+			es.biases[i] = mat.DenseCopyOf(l.Biases())
+		}
+	}
+}
+
+// restore copies remembered parameters into the network. Parameters are
+// copied in place, as optimizers keep their state per matrix
+func (es *EarlyStopping) restore(n *Network) {
+	for i, l := range n.trainable() {
+		l.Weights().Copy(es.weights[i])
+
+		if es.biases[i] != nil {
+			l.Biases().Copy(es.biases[i])
+		}
+	}
+}
+
+// BatchInfo describes a batch for batch callbacks. Batches are counted from one
+// within an epoch, while steps are counted across all epochs. Loss and
+// GradientNorm are only known once the batch is processed.
+type BatchInfo struct {
+	Epoch        int
+	Batch        int
+	Batches      int
+	Step         int
+	Steps        int
+	Size         int
+	LearningRate float64
+	// Loss is the mean loss of samples of the batch
+	Loss float64
+	// GradientNorm is the L2 norm of the mean gradient of all parameters
+	// before clipping (see FitOptions.ClipNorm)
+	GradientNorm float64
+}
+
+// TrainBeginCallback is an optional interface of callbacks called before the
+// first epoch
+type TrainBeginCallback interface {
+	OnTrainBegin(n *Network, o FitOptions)
+}
+
+// TrainEndCallback is an optional interface of callbacks called once training
+// is over, including when it is stopped by a callback
+type TrainEndCallback interface {
+	OnTrainEnd(n *Network, ev Evaluation)
+}
+
+// EpochBeginCallback is an optional interface of callbacks called before every
+// epoch
+type EpochBeginCallback interface {
+	OnEpochBegin(n *Network, epoch int, lr float64)
+}
+
+// BatchBeginCallback is an optional interface of callbacks called before every
+// batch
+type BatchBeginCallback interface {
+	OnBatchBegin(n *Network, b BatchInfo)
+}
+
+// BatchEndCallback is an optional interface of callbacks called after weights
+// are updated with every batch
+type BatchEndCallback interface {
+	OnBatchEnd(n *Network, b BatchInfo)
+}
+
+func (n *Network) onTrainBegin(o FitOptions) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(TrainBeginCallback); ok {
+			cb.OnTrainBegin(n, o)
+		}
+	}
+}
+
+func (n *Network) onTrainEnd(ev Evaluation) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(TrainEndCallback); ok {
+			cb.OnTrainEnd(n, ev)
+		}
+	}
+}
+
+func (n *Network) onEpochBegin(epoch int, lr float64) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(EpochBeginCallback); ok {
+			cb.OnEpochBegin(n, epoch, lr)
+		}
+	}
+}
+
+func (n *Network) onBatchBegin(b BatchInfo) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(BatchBeginCallback); ok {
+			cb.OnBatchBegin(n, b)
+		}
+	}
+}
+
+func (n *Network) onBatchEnd(b BatchInfo) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(BatchEndCallback); ok {
+			cb.OnBatchEnd(n, b)
+		}
+	}
+}
+
+type Snapshot struct {
+	schedule *SGDRLearningRate
+	saver    Exporter
+	pattern  string
+}
+
+// NewSnapshot creates a Callback that exports models at the end of every cycle
+// of SGDR, right before the learning rate restarts. Models of all cycles form
+// a snapshot ensemble (Huang et al., https://doi.org/10.48550/arXiv.1704.00109).
+// The schedule may be SGDR wrapped into other schedules (i.e., Warmup). Files
+// are named by the pattern with %d for the number of the cycle (e.g.,
+// "snapshots/model-%d.json"), which is "snapshot-%d.json" if empty. Cycles are
+// counted from the first epoch of training, so that snapshots of training
+// resumed from a checkpoint do not overwrite earlier ones
+func NewSnapshot(saver Exporter, schedule LearningRate, pattern string) Callback {
+	sgdr, ok := unwrapSchedule[*SGDRLearningRate](schedule)
+	if !ok {
+		log.Fatalln(fmt.Errorf("snapshots need the SGDR learning rate, got %T", schedule))
+	}
+
+	if pattern == "" {
+		pattern = "snapshot-%d.json"
+	}
+
+	if strings.Count(pattern, "%d") != 1 || strings.Count(pattern, "%") != 1 {
+		log.Fatalln(fmt.Errorf("snapshot pattern %q must have a single %%d for the cycle", pattern))
+	}
+
+	return &Snapshot{
+		schedule: sgdr,
+		saver:    saver,
+		pattern:  pattern,
+	}
+}
+
+func (s *Snapshot) AfterEpoch(n *Network, epoch int, _ Evaluation) bool {
+	cycle, ok := s.schedule.Restart(epoch)
+	if !ok {
+		return true
+	}
+
+	filename := fmt.Sprintf(s.pattern, cycle)
+
+	fp, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("failed to open file %s: %w", filename, err))
+	}
+	defer fp.Close()
+
+	if err = s.saver.Save(fp, n); err != nil {
+		log.Fatalln(fmt.Errorf("failed to save network: %w", err))
 	}
 
 	return true
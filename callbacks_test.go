@@ -0,0 +1,217 @@
+package deeper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// epochLog returns an evaluation holding a single metric
+func epochLog(name string, v float64) Evaluation {
+	var ev Evaluation
+	ev.set(name, v)
+	return ev
+}
+
+func TestEarlyStoppingOrder(t *testing.T) {
+	n := NewNetwork()
+	accuracy := []float64{0.5, 0.6, 0.6, 0.7}
+
+	// the legacy callback checks the wait before counting the epoch
+	legacy := NewEarlyStopping(2)
+	options := NewEarlyStoppingWithOptions(EarlyStoppingOptions{WaitEpochs: 2})
+	for i, acc := range accuracy[:3] {
+		if !legacy.AfterEpoch(n, i+1, epochLog("val_acc", acc)) || !options.AfterEpoch(n, i+1, epochLog("val_acc", acc)) {
+			t.Fatalf("stopped at epoch %d", i+1)
+		}
+	}
+	if legacy.AfterEpoch(n, 4, epochLog("val_acc", accuracy[3])) {
+		t.Fatal("legacy early stopping counted the improvement of epoch 4")
+	}
+	if !options.AfterEpoch(n, 4, epochLog("val_acc", accuracy[3])) {
+		t.Fatal("early stopping ignored the improvement of epoch 4")
+	}
+}
+
+func TestEarlyStoppingRestoreBestWeights(t *testing.T) {
+	n := newLinearNet()
+	w := n.Layers[1].Weights()
+
+	es := NewEarlyStoppingWithOptions(EarlyStoppingOptions{Monitor: Monitor{Metric: "val_loss", MinDelta: 1e-3}, WaitEpochs: 2, RestoreBestWeights: true})
+	best := mat.DenseCopyOf(w)
+	for epoch, loss := range []float64{1, 0.5, 0.4995, 0.6} {
+		if epoch > 0 {
+			w.Scale(2, w)
+		}
+		if epoch == 1 {
+			best = mat.DenseCopyOf(w)
+		}
+		if cont := es.AfterEpoch(n, epoch+1, epochLog("val_loss", loss)); cont != (epoch < 3) {
+			t.Fatalf("epoch %d: continue is %v", epoch+1, cont)
+		}
+	}
+
+	if !mat.Equal(w, best) {
+		t.Fatal("weights of the best epoch are not restored")
+	}
+}
+
+func TestSaveBestThreshold(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	n := newLinearNet()
+
+	// the legacy callback saves models more accurate than the threshold of 0
+	NewSaveBest(NewExporter(), 0).AfterEpoch(n, 1, epochLog("val_acc", 0))
+	if _, err := os.Stat("model-0.0000.json"); err == nil {
+		t.Fatal("model of zero accuracy is saved")
+	}
+
+	NewSaveBestWithOptions(NewExporter(), SaveBestOptions{}).AfterEpoch(n, 1, epochLog("val_acc", 0))
+	if _, err := os.Stat("model-0.0000.json"); err != nil {
+		t.Fatal("model without threshold is not saved")
+	}
+}
+
+// weightsLog keeps weights of the last layer after every epoch
+type weightsLog []*mat.Dense
+
+func (w *weightsLog) AfterEpoch(n *Network, _ int, _ Evaluation) bool {
+	*w = append(*w, mat.DenseCopyOf(n.Layers[len(n.Layers)-1].Weights()))
+	return true
+}
+
+func TestEarlyStoppingRestoreBestWeightsAfterLastEpoch(t *testing.T) {
+	n := newLinearNet()
+	weights := &weightsLog{}
+	n.AddCallback(NewEarlyStoppingWithOptions(EarlyStoppingOptions{Monitor: Monitor{Metric: "val_loss"}, WaitEpochs: 10, RestoreBestWeights: true}))
+	n.AddCallback(weights)
+
+	// training diverges, so the best epoch is not the last one
+	x, y := regData(64)
+	h := n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 4, BatchSize: 8, LearningRate: NewFlatLearningRate(5)})
+	if len(h.Epochs) != 4 {
+		t.Fatalf("training stopped after %d epochs", len(h.Epochs))
+	}
+
+	best := 0
+	for i, e := range h.Epochs {
+		if e.Metrics["val_loss"] < h.Epochs[best].Metrics["val_loss"] {
+			best = i
+		}
+	}
+	if best == 3 {
+		t.Fatal("the last epoch is the best one")
+	}
+	if !mat.Equal(n.Layers[1].Weights(), (*weights)[best]) {
+		t.Fatalf("weights of the best epoch %d are not restored", best+1)
+	}
+}
+
+// recorder records names of hooks in the order they are called
+type recorder struct {
+	events  []string
+	batches []BatchInfo
+}
+
+func (r *recorder) AfterEpoch(*Network, int, Evaluation) bool {
+	r.events = append(r.events, "after_epoch")
+	return true
+}
+
+func (r *recorder) OnTrainBegin(*Network, FitOptions) {
+	r.events = append(r.events, "train_begin")
+}
+
+func (r *recorder) OnTrainEnd(*Network, Evaluation) {
+	r.events = append(r.events, "train_end")
+}
+
+func (r *recorder) OnEpochBegin(*Network, int, float64) {
+	r.events = append(r.events, "epoch_begin")
+}
+
+func (r *recorder) OnBatchBegin(*Network, BatchInfo) {
+	r.events = append(r.events, "batch_begin")
+}
+
+func (r *recorder) OnBatchEnd(_ *Network, b BatchInfo) {
+	r.events = append(r.events, "batch_end")
+	r.batches = append(r.batches, b)
+}
+
+func TestCallbackHooks(t *testing.T) {
+	n := newLinearNet()
+	r := &recorder{}
+	n.AddCallback(r)
+	x, y := regData(20)
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+
+	epoch := []string{"epoch_begin", "batch_begin", "batch_end", "batch_begin", "batch_end", "after_epoch"}
+	want := append(append(append([]string{"train_begin"}, epoch...), epoch...), "train_end")
+	if strings.Join(r.events, " ") != strings.Join(want, " ") {
+		t.Fatalf("hooks are called as %v", r.events)
+	}
+
+	last := r.batches[len(r.batches)-1]
+	if last.Epoch != 2 || last.Batch != 2 || last.Batches != 2 || last.Step != 4 || last.Steps != 4 || last.Size != 4 || last.LearningRate != 0.1 {
+		t.Fatalf("last batch is %+v", last)
+	}
+}
+
+func TestSnapshotOfWrappedSGDR(t *testing.T) {
+	n := newLinearNet()
+
+	dir := t.TempDir()
+	lr := NewWarmup(NewSGDRLearningRate(0.01, 0, 1, 2), WarmupOptions{Epochs: 1})
+	n.AddCallback(NewSnapshot(NewExporter(), lr, filepath.Join(dir, "model-%d.json")))
+	x, y := regData(20)
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 4, BatchSize: 5, LearningRate: lr})
+
+	// cycles of 1, 2 and 4 epochs end after epochs 1 and 3
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "model-1.json" || filepath.Base(files[1]) != "model-2.json" {
+		t.Fatalf("snapshots are %v", files)
+	}
+}
+
+func TestSnapshotOfResumedTraining(t *testing.T) {
+	n := newLinearNet()
+
+	dir := t.TempDir()
+	lr := NewSGDRLearningRate(0.01, 0, 1, 2)
+	n.AddCallback(NewSnapshot(NewExporter(), lr, filepath.Join(dir, "model-%d.json")))
+	x, y := regData(20)
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 2, BatchSize: 5, LearningRate: lr})
+	first, err := os.ReadFile(filepath.Join(dir, "model-1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second cycle ends after epoch 3 of the resumed training
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 4, InitialEpoch: 2, BatchSize: 5, LearningRate: lr})
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[1]) != "model-2.json" {
+		t.Fatalf("snapshots are %v", files)
+	}
+	if again, err := os.ReadFile(files[0]); err != nil || !bytes.Equal(again, first) {
+		t.Fatal("the snapshot of the first cycle is overwritten")
+	}
+}
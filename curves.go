@@ -0,0 +1,318 @@
+package deeper
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	CurveROC = iota
+	CurvePR
+)
+
+// Scores collects predicted probabilities of every class along with true
+// classes of samples, from which ROC and precision-recall curves are built.
+// Outputs of a single neuron (i.e., sigmoid for binary classification) are
+// treated as the probability of class 1, with 1 - p for class 0.
+type Scores struct {
+	classes int
+	scores  [][]float64
+	truth   []int
+}
+
+// NewScores creates an empty collection of scores
+func NewScores() *Scores {
+	return &Scores{}
+}
+
+// Add adds predicted probabilities and the true class of a single sample
+func (s *Scores) Add(prediction, truth *mat.Dense) {
+	p := slices.Clone(prediction.RawMatrix().Data)
+
+	if len(p) == 1 {
+		p = []float64{1 - p[0], p[0]}
+	}
+
+	if s.classes == 0 {
+		s.classes = len(p)
+	}
+
+	s.scores = append(s.scores, p)
+	s.truth = append(s.truth, class(truth))
+}
+
+// Reset removes all samples
+func (s *Scores) Reset() {
+	s.scores, s.truth = nil, nil
+}
+
+// Classes returns the number of classes
+func (s *Scores) Classes() int {
+	return s.classes
+}
+
+// Curve is a ROC (false positive rate in X, true positive rate in Y) or a
+// precision-recall (recall in X, precision in Y) curve of a single class
+// against all other classes. A sample is predicted positive when its score is
+// greater than or equal to the threshold of a point.
+type Curve struct {
+	Kind       int
+	Class      int
+	Thresholds []float64
+	X          []float64
+	Y          []float64
+	// AUC is the area under the ROC curve computed with the trapezoidal rule,
+	// or the average precision (a step-wise area that does not interpolate
+	// between points) for precision-recall curves. It is NaN when the class
+	// has no positive or no negative samples
+	AUC float64
+}
+
+// ROC builds the ROC curve of a class against all other classes
+func (s *Scores) ROC(class int) Curve {
+	return s.curve(CurveROC, class)
+}
+
+// PR builds the precision-recall curve of a class against all other classes
+func (s *Scores) PR(class int) Curve {
+	return s.curve(CurvePR, class)
+}
+
+// ROCAUC returns the area under the ROC curve of class 1 for binary models and
+// the macro average of one-vs-rest areas for multiclass ones
+func (s *Scores) ROCAUC() float64 {
+	return s.auc(CurveROC)
+}
+
+// PRAUC returns the average precision of class 1 for binary models and the
+// macro average of one-vs-rest average precisions for multiclass ones
+func (s *Scores) PRAUC() float64 {
+	return s.auc(CurvePR)
+}
+
+// auc averages areas of classes that have both positive and negative samples,
+// as curves are undefined for the others. Binary models have only the area of
+// class 1. It returns NaN when no class has an area
+func (s *Scores) auc(kind int) float64 {
+	classes := []int{1}
+
+	if s.classes != 2 {
+		classes = make([]int, s.classes)
+
+		for c := range classes {
+			classes[c] = c
+		}
+	}
+
+	sum, count := float64(0), 0
+
+	for _, c := range classes {
+		if area := s.curve(kind, c).AUC; !math.IsNaN(area) {
+			sum += area
+			count++
+		}
+	}
+
+	if count == 0 {
+		return math.NaN()
+	}
+
+	return sum / float64(count)
+}
+
+// curve sweeps thresholds from the highest score to the lowest one, adding a
+// point for every distinct score
+func (s *Scores) curve(kind, class int) Curve {
+	if class < 0 || class >= s.classes {
+		log.Fatalln(fmt.Errorf("class %d is out of %d classes", class, s.classes))
+	}
+
+	order := make([]int, len(s.truth))
+	positives := 0
+
+	for i := range order {
+		order[i] = i
+
+		if s.truth[i] == class {
+			positives++
+		}
+	}
+
+	negatives := len(order) - positives
+
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(s.scores[b][class], s.scores[a][class])
+	})
+
+	c := Curve{Kind: kind, Class: class}
+
+	if kind == CurveROC {
+		c.add(math.Inf(1), 0, 0)
+	}
+
+	tp, fp := 0, 0
+
+	for i, j := range order {
+		if s.truth[j] == class {
+			tp++
+		} else {
+			fp++
+		}
+
+		threshold := s.scores[j][class]
+
+		// Samples of the same score are on the same side of any threshold
+		if i+1 < len(order) && s.scores[order[i+1]][class] == threshold {
+			continue
+		}
+
+		recall := ratio(tp, positives)
+
+		switch kind {
+		case CurveROC:
+			fpr := ratio(fp, negatives)
+			c.AUC += (fpr - c.X[len(c.X)-1]) * (recall + c.Y[len(c.Y)-1]) / 2
+			c.add(threshold, fpr, recall)
+		case CurvePR:
+			previous := float64(0)
+
+			if len(c.X) > 0 {
+				previous = c.X[len(c.X)-1]
+			}
+
+			precision := ratio(tp, tp+fp)
+			c.AUC += (recall - previous) * precision
+			c.add(threshold, recall, precision)
+		}
+	}
+
+	if positives == 0 || negatives == 0 {
+		c.AUC = math.NaN()
+	}
+
+	return c
+}
+
+func (c *Curve) add(threshold, x, y float64) {
+	c.Thresholds = append(c.Thresholds, threshold)
+	c.X = append(c.X, x)
+	c.Y = append(c.Y, y)
+}
+
+// OptimalThreshold returns the threshold that maximizes Youden's J statistic
+// (TPR - FPR) for ROC curves or the F1 score for precision-recall curves
+func (c Curve) OptimalThreshold() float64 {
+	best, threshold := math.Inf(-1), math.NaN()
+
+	for i := range c.Thresholds {
+		var v float64
+
+		switch c.Kind {
+		case CurveROC:
+			v = c.Y[i] - c.X[i]
+		case CurvePR:
+			v = f1(c.Y[i], c.X[i])
+		}
+
+		if v > best && !math.IsInf(c.Thresholds[i], 0) {
+			best, threshold = v, c.Thresholds[i]
+		}
+	}
+
+	return threshold
+}
+
+// WriteCSV writes points of the curve as CSV with a header: threshold, fpr and
+// tpr for ROC curves, or threshold, recall and precision for precision-recall
+// curves
+func (c Curve) WriteCSV(dst io.Writer) error {
+	w := csv.NewWriter(dst)
+
+	header := []string{"threshold", "fpr", "tpr"}
+
+	if c.Kind == CurvePR {
+		header = []string{"threshold", "recall", "precision"}
+	}
+
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("could not write curve: %w", err)
+	}
+
+	for i := range c.Thresholds {
+		record := []string{
+			strconv.FormatFloat(c.Thresholds[i], 'g', -1, 64),
+			strconv.FormatFloat(c.X[i], 'g', -1, 64),
+			strconv.FormatFloat(c.Y[i], 'g', -1, 64),
+		}
+
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("could not write curve: %w", err)
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// CollectScores passes samples through a network with a single output and
+// collects predicted probabilities for ROC and precision-recall curves
+func (n *Network) CollectScores(x, y []*mat.Dense) *Scores {
+	samples, err := n.samples(x, y, nil, nil)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid evaluation set: %w", err))
+	}
+
+	s := NewScores()
+
+	for _, smp := range samples {
+		s.Add(n.predict(smp.x)[0], smp.y[0])
+	}
+
+	return s
+}
+
+type AUC struct {
+	kind   int
+	scores *Scores
+}
+
+// NewROCAUC creates a metric computing the area under the ROC curve, which is
+// one-vs-rest macro average for multiclass models
+func NewROCAUC() Metric {
+	return &AUC{kind: CurveROC, scores: NewScores()}
+}
+
+// NewPRAUC creates a metric computing the average precision, which is
+// one-vs-rest macro average for multiclass models
+func NewPRAUC() Metric {
+	return &AUC{kind: CurvePR, scores: NewScores()}
+}
+
+func (m *AUC) Name() string {
+	if m.kind == CurvePR {
+		return "pr_auc"
+	}
+
+	return "roc_auc"
+}
+
+func (m *AUC) Reset() {
+	m.scores.Reset()
+}
+
+func (m *AUC) Add(prediction, truth *mat.Dense) {
+	m.scores.Add(prediction, truth)
+}
+
+func (m *AUC) Result() float64 {
+	return m.scores.auc(m.kind)
+}
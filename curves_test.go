@@ -0,0 +1,81 @@
+package deeper
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func binaryScores(predictions, truth []float64) *Scores {
+	s := NewScores()
+	for i, p := range predictions {
+		s.Add(mat.NewDense(1, 1, []float64{p}), mat.NewDense(1, 1, []float64{truth[i]}))
+	}
+	return s
+}
+
+func TestBinaryAUC(t *testing.T) {
+	// sklearn: roc_auc_score and average_precision_score
+	s := binaryScores([]float64{0.1, 0.4, 0.35, 0.8}, []float64{0, 0, 1, 1})
+	if math.Abs(s.ROCAUC()-0.75) > 1e-9 {
+		t.Fatalf("ROC AUC is %v", s.ROCAUC())
+	}
+	if math.Abs(s.PRAUC()-5.0/6) > 1e-9 {
+		t.Fatalf("PR AUC is %v", s.PRAUC())
+	}
+	// thresholds 0.8 and 0.35 have the same J, the highest one comes first
+	if th := s.ROC(1).OptimalThreshold(); th != 0.8 {
+		t.Fatalf("optimal ROC threshold is %v", th)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ROC(1).WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); lines[0] != "threshold,fpr,tpr" {
+		t.Fatalf("header is %q", lines[0])
+	}
+}
+
+func TestMulticlassAUC(t *testing.T) {
+	s := NewScores()
+	for _, r := range []struct {
+		p []float64
+		y int
+	}{
+		{[]float64{.7, .2, .1}, 0},
+		{[]float64{.2, .5, .3}, 1},
+		{[]float64{.1, .3, .6}, 2},
+		{[]float64{.4, .4, .2}, 1},
+		{[]float64{.3, .3, .4}, 0},
+	} {
+		s.Add(mat.NewDense(3, 1, r.p), oneHot(3, r.y))
+	}
+	if math.Abs(s.ROCAUC()-17.0/18) > 1e-9 {
+		t.Fatalf("ROC AUC is %v", s.ROCAUC())
+	}
+}
+
+func TestDegenerateAUC(t *testing.T) {
+	// a single class in truth has no curve
+	if auc := binaryScores([]float64{0.2, 0.7}, []float64{1, 1}).ROCAUC(); !math.IsNaN(auc) {
+		t.Fatalf("binary AUC without negatives is %v", auc)
+	}
+
+	// classes without samples are skipped in the multiclass average
+	s := NewScores()
+	s.Add(mat.NewDense(3, 1, []float64{.6, .3, .1}), oneHot(3, 0))
+	s.Add(mat.NewDense(3, 1, []float64{.3, .6, .1}), oneHot(3, 1))
+	if auc := s.ROCAUC(); auc != 1 {
+		t.Fatalf("multiclass AUC with an empty class is %v", auc)
+	}
+
+	s.Reset()
+	s.Add(mat.NewDense(3, 1, []float64{.6, .3, .1}), oneHot(3, 0))
+	if auc := s.ROCAUC(); !math.IsNaN(auc) {
+		t.Fatalf("multiclass AUC of a single class is %v", auc)
+	}
+}
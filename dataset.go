@@ -0,0 +1,102 @@
+package deeper
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// sample holds inputs and targets of a single sample in the same order as
+// inputs and outputs of a network
+type sample struct {
+	x []*mat.Dense
+	y []*mat.Dense
+}
+
+// samples turns either unnamed (x and y) or named (inputs and targets) sets of
+// matrices into samples. Named sets are matched with inputs and outputs of a
+// graph by their names, while unnamed ones are only accepted by networks with
+// a single input and a single output.
+func (n *Network) samples(x, y []*mat.Dense, inputs, targets map[string][]*mat.Dense) ([]sample, error) {
+	if len(inputs) == 0 && len(targets) == 0 {
+		if n.graph != nil && (len(n.graph.inputs) != 1 || len(n.graph.outputs) != 1) {
+			return nil, fmt.Errorf("graphs with several inputs or outputs need named inputs and targets")
+		}
+
+		if len(x) != len(y) {
+			return nil, fmt.Errorf("x and y must be of the same size, got %d and %d", len(x), len(y))
+		}
+
+		samples := make([]sample, len(x))
+
+		for i := range x {
+			samples[i] = sample{x: []*mat.Dense{x[i]}, y: []*mat.Dense{y[i]}}
+		}
+
+		return samples, nil
+	}
+
+	if n.graph == nil {
+		return nil, fmt.Errorf("named inputs and targets need a graph")
+	}
+
+	inputNames := make([]string, len(n.graph.inputs))
+
+	for i, in := range n.graph.inputs {
+		inputNames[i] = in.name
+	}
+
+	xs, err := named("input", inputNames, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	ys, err := named("target", n.graph.outputNames, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(xs[0])
+
+	for _, set := range append(xs, ys...) {
+		if len(set) != size {
+			return nil, fmt.Errorf("all inputs and targets must be of the same size")
+		}
+	}
+
+	samples := make([]sample, size)
+
+	for i := range samples {
+		samples[i] = sample{x: make([]*mat.Dense, len(xs)), y: make([]*mat.Dense, len(ys))}
+
+		for j := range xs {
+			samples[i].x[j] = xs[j][i]
+		}
+
+		for j := range ys {
+			samples[i].y[j] = ys[j][i]
+		}
+	}
+
+	return samples, nil
+}
+
+// named orders named sets as names go
+func named(kind string, names []string, sets map[string][]*mat.Dense) ([][]*mat.Dense, error) {
+	ordered := make([][]*mat.Dense, len(names))
+
+	for i, name := range names {
+		set, ok := sets[name]
+		if !ok {
+			return nil, fmt.Errorf("%s %q is missing", kind, name)
+		}
+
+		ordered[i] = set
+	}
+
+	if len(sets) != len(names) {
+		return nil, fmt.Errorf("%d %ss expected, got %d", len(names), kind, len(sets))
+	}
+
+	return ordered, nil
+}
@@ -0,0 +1,150 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type Embedding struct {
+	rows       int
+	vocabulary int
+	input      BackpropagationLayer
+	output     BackpropagationLayer
+	weights    *mat.Dense
+}
+
+// NewEmbedding creates a layer that maps integer indices (i.e., tokens or
+// categorical IDs) in range [0, vocabulary) to trainable dense vectors of the
+// given size. Its weights are a vocabulary x dimensions table, where every row
+// is a vector for a single index. Embedding has no biases.
+func NewEmbedding(vocabulary, dimensions int) BackpropagationLayer {
+	return &Embedding{
+		rows:       dimensions,
+		vocabulary: vocabulary,
+	}
+}
+
+// Rows returns the size of vectors, as this is what the next layer receives
+func (l *Embedding) Rows() int {
+	return l.rows
+}
+
+// Cols returns the size of the vocabulary. Unlike fully connected layers, the
+// weights of Embedding are stored transposed, Cols() x Rows()
+func (l *Embedding) Cols() int {
+	return l.vocabulary
+}
+
+func (l *Embedding) IsInput() bool {
+	return false
+}
+
+func (l *Embedding) IsOutput() bool {
+	return false
+}
+
+func (l *Embedding) Weights() *mat.Dense {
+	return l.weights
+}
+
+func (l *Embedding) Biases() *mat.Dense {
+	return nil
+}
+
+func (l *Embedding) SetWeights(w *mat.Dense) {
+	l.weights = w
+}
+
+func (l *Embedding) SetBiases(_ *mat.Dense) {
+}
+
+func (l *Embedding) SetInput(input BackpropagationLayer) {
+	l.input = input
+}
+
+func (l *Embedding) SetOutput(output BackpropagationLayer) {
+	l.output = output
+}
+
+// InitParameters initializes the table of vectors
+func (l *Embedding) InitParameters(wi WeightInitializer) {
+	l.weights = wi.InitWeights(l.vocabulary, l.rows)
+}
+
+// Feedforward looks up a vector for every index in x and returns them as a
+// sequence (a dimensions x indices matrix with one column per index). Indices
+// are read row by row, so both a row and a column of indices are sequences.
+func (l *Embedding) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	indices := l.indices(x)
+	y := mat.NewDense(l.rows, len(indices), nil)
+
+	for t, i := range indices {
+		y.SetCol(t, l.weights.RawRowView(i))
+	}
+
+	if activations != nil {
+		activations.Push(y)
+	}
+
+	if l.output != nil {
+		return l.output.Feedforward(y, activations)
+	}
+
+	return y
+}
+
+// Backpropagation computes updates only for rows of the table that were looked
+// up, summing errors of repeated indices, and pushes them as a sparse update.
+// Indices are not differentiable, so no error is passed to the previous layer.
+func (l *Embedding) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop()
+	indices := l.indices(activations.Peek())
+
+	positions := make(map[int]int, len(indices))
+	rows := make([]int, 0, len(indices))
+
+	for _, i := range indices {
+		if _, ok := positions[i]; !ok {
+			positions[i] = len(rows)
+			rows = append(rows, i)
+		}
+	}
+
+	deltaW := mat.NewDense(len(rows), l.rows, nil)
+
+	for t, i := range indices {
+		row := deltaW.RawRowView(positions[i])
+
+		for j := range l.rows {
+			row[j] += delta.At(j, t)
+		}
+	}
+
+	deltaWs.PushSparse(deltaW, rows)
+	deltaBs.Push(nil)
+
+	if l.input != nil {
+		l.input.Backpropagation(nil, activations, deltaWs, deltaBs)
+	}
+}
+
+func (l *Embedding) indices(x *mat.Dense) []int {
+	r, c := x.Dims()
+	indices := make([]int, 0, r*c)
+
+	for i := range r {
+		for j := range c {
+			idx := int(x.At(i, j))
+
+			if idx < 0 || idx >= l.vocabulary {
+				log.Fatalln(fmt.Errorf("index %d is out of vocabulary of size %d", idx, l.vocabulary))
+			}
+
+			indices = append(indices, idx)
+		}
+	}
+
+	return indices
+}
@@ -0,0 +1,104 @@
+package deeper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// tokenData returns sequences of four tokens labeled by whether token 7 is
+// among them
+func tokenData(k int) ([]*mat.Dense, []*mat.Dense) {
+	var xs, ys []*mat.Dense
+	for i := range k {
+		x := mat.NewDense(1, 4, nil)
+		y := mat.NewDense(2, 1, nil)
+		class := 0
+		for j := range 4 {
+			v := float64((i*7 + j*3 + i/3) % 10)
+			x.Set(0, j, v)
+			if v == 7 {
+				class = 1
+			}
+		}
+		y.Set(class, 0, 1)
+		xs, ys = append(xs, x), append(ys, y)
+	}
+	return xs, ys
+}
+
+// assertSamePredictions fails unless both networks predict the same values
+func assertSamePredictions(t *testing.T, a, b *Network, xs []*mat.Dense) {
+	t.Helper()
+	for i, x := range xs {
+		if !mat.Equal(forwardOf(a, x), forwardOf(b, x)) {
+			t.Fatalf("predictions of sample %d differ", i)
+		}
+	}
+}
+
+// roundTrip saves n and loads it into a new network
+func roundTrip(t *testing.T, n *Network) *Network {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewExporter().Save(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	m := NewNetwork()
+	if err := NewExporter().Load(m, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEmbeddingGradients(t *testing.T) {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(1))
+	n.AddLayer(NewEmbedding(7, 3))
+	n.AddLayer(NewLSTM(4, RecurrentOptions{}))
+	n.AddLayer(NewOutputLayer(2, identity{}))
+	// repeated tokens sum their updates
+	gradCheck(t, n, mat.NewDense(1, 5, []float64{1, 3, 1, 6, 0}), rnd(2, 1))
+}
+
+func TestEmbeddingExport(t *testing.T) {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(1))
+	n.AddLayer(NewEmbedding(10, 4))
+	n.AddLayer(NewGRU(6, RecurrentOptions{}))
+	n.AddLayer(NewOutputLayer(2, NewSoftmax()))
+	n.SetOptimizer(NewSGD(0.9, true))
+	n.SetLossFunction(NewCategoricalCrossEntropy(ReductionMean))
+	n.SetVerbosity(VerbosityQuiet)
+	tx, ty := tokenData(200)
+	n.Fit(FitOptions{TrainX: tx, TrainY: ty, ValX: tx, ValY: ty, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+	assertSamePredictions(t, n, roundTrip(t, n), tx)
+}
+
+// assertInvalidNetworks fails unless loading of every saved network fails
+func assertInvalidNetworks(t *testing.T, networks ...string) {
+	t.Helper()
+	for _, s := range networks {
+		if err := NewExporter().Load(NewNetwork(), strings.NewReader(s)); err == nil {
+			t.Errorf("%s is loaded", s)
+		}
+	}
+}
+
+func TestLoadMalformedLayers(t *testing.T) {
+	input := `{"type":"input","neurons":2}`
+	assertInvalidNetworks(t,
+		`{"layers":[`+input+`,{"type":"hidden","neurons":2,"activation":"tanh","weights":{"rows":0,"cols":0},"biases":{"rows":2,"cols":1,"data":[0,0]}}]}`,
+		`{"layers":[`+input+`,{"type":"hidden","neurons":2,"activation":"tanh","weights":{"rows":2,"cols":2,"data":[1,2,3]},"biases":{"rows":2,"cols":1,"data":[0,0]}}]}`,
+		`{"layers":[`+input+`,{"type":"hidden","neurons":2,"activation":"tanh","weights":{"rows":2,"cols":3,"data":[1,2,3,4,5,6]},"biases":{"rows":2,"cols":1,"data":[0,0]}}]}`,
+		`{"layers":[`+input+`,{"type":"hidden","neurons":2,"activation":"tanh","weights":{"rows":2,"cols":2,"data":[1,2,3,4]}}]}`,
+		`{"layers":[`+input+`,{"type":"hidden","neurons":2,"weights":{"rows":2,"cols":2,"data":[1,2,3,4]},"biases":{"rows":2,"cols":1,"data":[0,0]}}]}`,
+		`{"layers":[`+input+`,{"type":"lstm","neurons":1,"weights":{"rows":4,"cols":2,"data":[1,2,3,4,5,6,7,8]},"biases":{"rows":4,"cols":1,"data":[0,0,0,0]}}]}`,
+		`{"layers":[`+input+`,{"type":"embedding","neurons":3,"weights":{"rows":2,"cols":2,"data":[1,2,3,4]}}]}`,
+		`{"layers":[{"type":"gru","neurons":1}]}`,
+		`{"sizes":[2,1],"weights":[{"rows":1,"cols":2,"data":[1]}],"biases":[{"rows":1,"cols":1,"data":[0]}]}`,
+		`{"sizes":[2,1]}`,
+	)
+}
@@ -13,6 +13,14 @@ type Exporter interface {
 	Load(dst *Network, src io.Reader) error
 }
 
+// Checkpointer is an Exporter that also saves and loads the state of training
+// along with networks, so that training may be resumed
+type Checkpointer interface {
+	Exporter
+	SaveCheckpoint(dst io.Writer, src *Network, c Checkpoint) error
+	LoadCheckpoint(dst *Network, src io.Reader) (Checkpoint, error)
+}
+
 type Export struct{}
 
 type jsonMatrix struct {
@@ -21,10 +29,101 @@ type jsonMatrix struct {
 	Data []float64 `json:"data"`
 }
 
+type jsonLayer struct {
+	Type            string      `json:"type"`
+	Neurons         int         `json:"neurons"`
+	Activation      string      `json:"activation,omitempty"`
+	ReturnSequences bool        `json:"return_sequences,omitempty"`
+	TruncateSteps   int         `json:"truncate_steps,omitempty"`
+	Heads           int         `json:"heads,omitempty"`
+	Causal          bool        `json:"causal,omitempty"`
+	Weights         *jsonMatrix `json:"weights,omitempty"`
+	Biases          *jsonMatrix `json:"biases,omitempty"`
+}
+
+type jsonNode struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	Neurons int    `json:"neurons,omitempty"`
+	Layer   int    `json:"layer,omitempty"`
+	Parents []int  `json:"parents,omitempty"`
+}
+
 type jsonNetwork struct {
-	Sizes   []int        `json:"sizes"`
-	Weights []jsonMatrix `json:"weights"`
-	Biases  []jsonMatrix `json:"biases"`
+	Sizes  []int       `json:"sizes"`
+	Layers []jsonLayer `json:"layers,omitempty"`
+
+	// Graphs refer to their layers by indexes in Layers
+	Nodes       []jsonNode `json:"nodes,omitempty"`
+	Outputs     []int      `json:"outputs,omitempty"`
+	OutputNames []string   `json:"output_names,omitempty"`
+
+	// Networks exported before layers were described one by one had only
+	// sizes and parameters of fully connected layers
+	Weights []jsonMatrix `json:"weights,omitempty"`
+	Biases  []jsonMatrix `json:"biases,omitempty"`
+
+	Checkpoint *jsonCheckpoint `json:"checkpoint,omitempty"`
+}
+
+type jsonCheckpoint struct {
+	Epoch        int            `json:"epoch"`
+	LearningRate *jsonSchedule  `json:"learning_rate,omitempty"`
+	Optimizer    *jsonOptimizer `json:"optimizer,omitempty"`
+}
+
+type jsonOptimizer struct {
+	Type     string               `json:"type"`
+	Momentum float64              `json:"momentum,omitempty"`
+	Nesterov bool                 `json:"nesterov,omitempty"`
+	Rho      float64              `json:"rho,omitempty"`
+	Epsilon  float64              `json:"epsilon,omitempty"`
+	States   []jsonOptimizerState `json:"states,omitempty"`
+}
+
+// jsonOptimizerState is the state of an optimizer for a parameter, which is
+// referred to by its index among weights and biases of trainable layers. Rows
+// of parameters with sparse updates have their own states
+type jsonOptimizerState struct {
+	Parameter int           `json:"parameter"`
+	Row       *int          `json:"row,omitempty"`
+	Matrices  []*jsonMatrix `json:"matrices"`
+}
+
+type jsonSchedule struct {
+	Type        string        `json:"type"`
+	Rate        float64       `json:"rate,omitempty"`
+	Final       float64       `json:"final,omitempty"`
+	Factor      float64       `json:"factor,omitempty"`
+	Every       int           `json:"every,omitempty"`
+	First       int           `json:"first,omitempty"`
+	Multiplier  int           `json:"multiplier,omitempty"`
+	Power       float64       `json:"power,omitempty"`
+	Boundaries  []int         `json:"boundaries,omitempty"`
+	Values      []float64     `json:"values,omitempty"`
+	Steps       int           `json:"steps,omitempty"`
+	Epochs      int           `json:"epochs,omitempty"`
+	Mode        int           `json:"mode,omitempty"`
+	StartFactor float64       `json:"start_factor,omitempty"`
+	Fraction    float64       `json:"fraction,omitempty"`
+	FinalFactor float64       `json:"final_factor,omitempty"`
+	MinMomentum float64       `json:"min_momentum,omitempty"`
+	MaxMomentum float64       `json:"max_momentum,omitempty"`
+	Metric      string        `json:"metric,omitempty"`
+	MinDelta    float64       `json:"min_delta,omitempty"`
+	Patience    int           `json:"patience,omitempty"`
+	Scale       float64       `json:"scale,omitempty"`
+	Wait        int           `json:"wait,omitempty"`
+	Best        *float64      `json:"best,omitempty"`
+	Schedule    *jsonSchedule `json:"schedule,omitempty"`
+}
+
+// Checkpoint holds the state of training, which is saved along with the
+// network to resume training later (see FitOptions.InitialEpoch)
+type Checkpoint struct {
+	// Epoch is the number of completed epochs
+	Epoch        int
+	LearningRate LearningRate
 }
 
 // NewExporter returns an interface for saving and loading trained models
@@ -32,25 +131,76 @@ func NewExporter() Exporter {
 	return &Export{}
 }
 
+// NewCheckpointer returns an interface for saving and loading networks along
+// with the state of their training
+func NewCheckpointer() Checkpointer {
+	return &Export{}
+}
+
 // Save exports an existing and likely trained network to a destination
 // (i.e., a file). This is responsibility of the caller to close the writer
 func (e *Export) Save(dst io.Writer, src *Network) error {
+	j, err := e.export(src)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(dst).Encode(j); err != nil {
+		return fmt.Errorf("could not marshal network: %w", err)
+	}
+
+	return nil
+}
+
+// SaveCheckpoint exports a network along with the state of its training,
+// including the optimizer of the network and its state. Optimizers of other
+// packages are not saved, so networks loaded from such checkpoints keep their
+// own optimizer. This is responsibility of the caller to close the writer
+func (e *Export) SaveCheckpoint(dst io.Writer, src *Network, c Checkpoint) error {
+	j, err := e.export(src)
+	if err != nil {
+		return err
+	}
+
+	j.Checkpoint = &jsonCheckpoint{Epoch: c.Epoch}
+
+	if c.LearningRate != nil {
+		if j.Checkpoint.LearningRate, err = exportSchedule(c.LearningRate); err != nil {
+			return fmt.Errorf("could not export learning rate: %w", err)
+		}
+	}
+
+	if src.optimizer != nil {
+		j.Checkpoint.Optimizer = exportOptimizer(src)
+	}
+
+	if err := json.NewEncoder(dst).Encode(j); err != nil {
+		return fmt.Errorf("could not marshal checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Export) export(src *Network) (jsonNetwork, error) {
 	j := jsonNetwork{}
 
 	for _, l := range src.Layers {
 		j.Sizes = append(j.Sizes, l.Rows())
 
-		if !l.IsInput() {
-			j.Weights = append(j.Weights, jsonMatrix{Data: l.Weights().RawMatrix().Data})
-			j.Biases = append(j.Biases, jsonMatrix{Data: l.Biases().RawMatrix().Data})
+		jl, err := exportLayer(l)
+		if err != nil {
+			return j, fmt.Errorf("could not export layer: %w", err)
 		}
+
+		j.Layers = append(j.Layers, jl)
 	}
 
-	if err := json.NewEncoder(dst).Encode(j); err != nil {
-		return fmt.Errorf("could not marshal network: %w", err)
+	if src.graph != nil {
+		j.Nodes, j.Outputs = exportGraph(src.graph)
+		j.OutputNames = src.graph.outputNames
 	}
 
-	return nil
+	return j, nil
 }
 
 // Load loads a previously exported network from its saved state for inference.
@@ -62,8 +212,104 @@ func (e *Export) Load(dst *Network, src io.Reader) error {
 		return fmt.Errorf("couldn't decode saved network: %w", err)
 	}
 
+	return e.load(dst, j)
+}
+
+// LoadCheckpoint loads a network saved with SaveCheckpoint along with the state
+// of its training. The saved optimizer, if any, is set on the network. This is
+// responsibility of the caller to close the reader.
+func (e *Export) LoadCheckpoint(dst *Network, src io.Reader) (Checkpoint, error) {
+	c := Checkpoint{}
+	j := jsonNetwork{}
+
+	if err := json.NewDecoder(src).Decode(&j); err != nil {
+		return c, fmt.Errorf("couldn't decode checkpoint: %w", err)
+	}
+
+	if j.Checkpoint == nil {
+		return c, fmt.Errorf("saved network has no checkpoint")
+	}
+
+	if err := e.load(dst, j); err != nil {
+		return c, err
+	}
+
+	c.Epoch = j.Checkpoint.Epoch
+
+	if j.Checkpoint.LearningRate != nil {
+		lr, err := importSchedule(j.Checkpoint.LearningRate)
+		if err != nil {
+			return c, fmt.Errorf("couldn't import learning rate: %w", err)
+		}
+
+		c.LearningRate = lr
+	}
+
+	if j.Checkpoint.Optimizer != nil {
+		o, err := importOptimizer(dst, j.Checkpoint.Optimizer)
+		if err != nil {
+			return c, fmt.Errorf("couldn't import optimizer: %w", err)
+		}
+
+		dst.SetOptimizer(o)
+	}
+
+	return c, nil
+}
+
+func (e *Export) load(dst *Network, j jsonNetwork) error {
 	dst.Layers = make([]BackpropagationLayer, 0)
 
+	if len(j.Layers) == 0 {
+		return e.loadSizes(dst, j)
+	}
+
+	layers := make([]BackpropagationLayer, 0, len(j.Layers))
+
+	for _, jl := range j.Layers {
+		l, err := importLayer(jl)
+		if err != nil {
+			return fmt.Errorf("couldn't import layer: %w", err)
+		}
+
+		layers = append(layers, l)
+	}
+
+	if len(j.Nodes) > 0 {
+		g, err := importGraph(j, layers)
+		if err != nil {
+			return fmt.Errorf("couldn't import graph: %w", err)
+		}
+
+		dst.SetGraph(g)
+		return nil
+	}
+
+	if !layers[0].IsInput() {
+		return fmt.Errorf("the first layer must be an input layer")
+	}
+
+	for i, l := range layers {
+		dst.AddLayerWoWeightInitialization(l)
+
+		if i == 0 {
+			continue
+		}
+
+		if err := checkParameters(l, layers[i-1].Rows()); err != nil {
+			return fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// loadSizes loads networks exported as sizes of fully connected layers
+func (e *Export) loadSizes(dst *Network, j jsonNetwork) error {
+	if len(j.Sizes) > 0 && (len(j.Weights) != len(j.Sizes)-1 || len(j.Biases) != len(j.Sizes)-1) {
+		return fmt.Errorf("%d weights and %d biases for %d layers", len(j.Weights), len(j.Biases), len(j.Sizes))
+	}
+
 	for i := range j.Sizes {
 		var l BackpropagationLayer
 
@@ -76,12 +322,640 @@ func (e *Export) Load(dst *Network, src io.Reader) error {
 		}
 
 		if !l.IsInput() {
-			l.SetWeights(mat.NewDense(j.Sizes[i], j.Sizes[i-1], j.Weights[i-1].Data))
-			l.SetBiases(mat.NewDense(j.Sizes[i], 1, j.Biases[i-1].Data))
+			if err := importParameters(l, &j.Weights[i-1], &j.Biases[i-1]); err != nil {
+				return fmt.Errorf("couldn't import layer: %w", err)
+			}
 		}
 
 		dst.AddLayerWoWeightInitialization(l)
+
+		if i > 0 {
+			if err := checkParameters(l, j.Sizes[i-1]); err != nil {
+				return fmt.Errorf("layer %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func exportGraph(g *Graph) ([]jsonNode, []int) {
+	nodes := make([]jsonNode, 0, len(g.nodes))
+	outputs := make([]int, 0, len(g.outputs))
+	layers := make(map[BackpropagationLayer]int)
+
+	for _, nd := range g.nodes {
+		j := jsonNode{}
+
+		for _, p := range nd.parents {
+			j.Parents = append(j.Parents, p.id)
+		}
+
+		switch nd.merge.(type) {
+		case nil:
+			if nd.input {
+				j.Type = "input"
+				j.Name = nd.name
+				j.Neurons = nd.rows
+			} else {
+				j.Type = "layer"
+				j.Layer = len(layers)
+				layers[nd.layer] = j.Layer
+			}
+		case addMerge:
+			j.Type = "add"
+		case concatMerge:
+			j.Type = "concat"
+		}
+
+		nodes = append(nodes, j)
+	}
+
+	for _, o := range g.outputs {
+		outputs = append(outputs, o.id)
+	}
+
+	return nodes, outputs
+}
+
+func importGraph(j jsonNetwork, layers []BackpropagationLayer) (*Graph, error) {
+	g := NewGraph()
+	used := make([]bool, len(layers))
+
+	for i, jn := range j.Nodes {
+		parents := make([]*Node, 0, len(jn.Parents))
+
+		for _, p := range jn.Parents {
+			if p < 0 || p >= i {
+				return nil, fmt.Errorf("node %d refers to unknown node %d", i, p)
+			}
+
+			parents = append(parents, g.nodes[p])
+		}
+
+		if jn.Type != "input" && len(parents) == 0 {
+			return nil, fmt.Errorf("node %d has no parents", i)
+		}
+
+		switch jn.Type {
+		case "input":
+			if jn.Neurons <= 0 || len(parents) > 0 {
+				return nil, fmt.Errorf("input node %d has invalid size or parents", i)
+			}
+
+			g.NamedInput(jn.Name, jn.Neurons)
+		case "layer":
+			if jn.Layer < 0 || jn.Layer >= len(layers) || len(parents) != 1 {
+				return nil, fmt.Errorf("node %d has invalid layer or parents", i)
+			}
+
+			l := layers[jn.Layer]
+
+			if l.IsInput() || used[jn.Layer] {
+				return nil, fmt.Errorf("layer %d cannot be used by node %d", jn.Layer, i)
+			}
+
+			if err := checkParameters(l, parents[0].rows); err != nil {
+				return nil, fmt.Errorf("layer %d: %w", jn.Layer, err)
+			}
+
+			used[jn.Layer] = true
+			g.Layer(l, parents[0])
+		case "add":
+			for _, p := range parents {
+				if p.rows != parents[0].rows {
+					return nil, fmt.Errorf("node %d adds outputs of sizes %d and %d", i, parents[0].rows, p.rows)
+				}
+			}
+
+			g.Add(parents...)
+		case "concat":
+			g.Concat(parents...)
+		default:
+			return nil, fmt.Errorf("unsupported node type %q", jn.Type)
+		}
+	}
+
+	for i, u := range used {
+		if !u {
+			return nil, fmt.Errorf("layer %d is not used by any node", i)
+		}
+	}
+
+	if len(j.OutputNames) > 0 && len(j.OutputNames) != len(j.Outputs) {
+		return nil, fmt.Errorf("%d output names for %d outputs", len(j.OutputNames), len(j.Outputs))
+	}
+
+	for i, o := range j.Outputs {
+		if o < 0 || o >= len(g.nodes) {
+			return nil, fmt.Errorf("unknown output node %d", o)
+		}
+
+		name := ""
+
+		if len(j.OutputNames) > 0 {
+			name = j.OutputNames[i]
+		}
+
+		g.NamedOutput(name, g.nodes[o])
+	}
+
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func exportLayer(l BackpropagationLayer) (jsonLayer, error) {
+	var err error
+
+	j := jsonLayer{
+		Neurons: l.Rows(),
+		Weights: exportMatrix(l.Weights()),
+		Biases:  exportMatrix(l.Biases()),
+	}
+
+	switch t := l.(type) {
+	case *Layer:
+		switch {
+		case t.isInput:
+			j.Type = "input"
+		case t.isOutput:
+			j.Type = "output"
+		default:
+			j.Type = "hidden"
+		}
+
+		if !t.isInput {
+			j.Activation, err = activationName(t.activation)
+		}
+	case *SimpleRNN:
+		j.Type = "simple_rnn"
+		j.ReturnSequences, j.TruncateSteps = t.ReturnSequences, t.TruncateSteps
+		j.Activation, err = activationName(t.activation)
+	case *LSTM:
+		j.Type = "lstm"
+		j.ReturnSequences, j.TruncateSteps = t.ReturnSequences, t.TruncateSteps
+	case *GRU:
+		j.Type = "gru"
+		j.ReturnSequences, j.TruncateSteps = t.ReturnSequences, t.TruncateSteps
+	case *Embedding:
+		j.Type = "embedding"
+	case *MultiHeadAttention:
+		j.Type = "multi_head_attention"
+		j.Heads, j.Causal = t.heads, t.causal
+	case *PositionalEncoding:
+		j.Type = "positional_encoding"
+	case *GlobalAveragePooling:
+		j.Type = "global_average_pooling"
+	default:
+		err = fmt.Errorf("unsupported layer %T", l)
+	}
+
+	return j, err
+}
+
+func importLayer(j jsonLayer) (BackpropagationLayer, error) {
+	var l BackpropagationLayer
+	var a Activation
+	var err error
+
+	if j.Activation != "" {
+		if a, err = newActivation(j.Activation); err != nil {
+			return nil, err
+		}
+	} else if j.Type == "hidden" || j.Type == "output" || j.Type == "simple_rnn" {
+		return nil, fmt.Errorf("%s layer has no activation", j.Type)
+	}
+
+	o := RecurrentOptions{
+		ReturnSequences: j.ReturnSequences,
+		TruncateSteps:   j.TruncateSteps,
+	}
+
+	switch j.Type {
+	case "input":
+		l = NewInputLayer(j.Neurons)
+	case "hidden":
+		l = NewHiddenLayer(j.Neurons, a)
+	case "output":
+		l = NewOutputLayer(j.Neurons, a)
+	case "simple_rnn":
+		l = NewSimpleRNN(j.Neurons, a, o)
+	case "lstm":
+		l = NewLSTM(j.Neurons, o)
+	case "gru":
+		l = NewGRU(j.Neurons, o)
+	case "embedding":
+		if j.Weights == nil {
+			return nil, fmt.Errorf("embedding has no table")
+		}
+
+		l = NewEmbedding(j.Weights.Rows, j.Neurons)
+	case "multi_head_attention":
+		l = NewMultiHeadAttention(j.Heads, j.Causal)
+	case "positional_encoding":
+		l = NewPositionalEncoding()
+	case "global_average_pooling":
+		l = NewGlobalAveragePooling()
+	default:
+		return nil, fmt.Errorf("unsupported layer type %q", j.Type)
+	}
+
+	if err := importParameters(l, j.Weights, j.Biases); err != nil {
+		return nil, fmt.Errorf("%s layer: %w", j.Type, err)
+	}
+
+	return l, nil
+}
+
+// importParameters sets weights and biases read from a file, if there are any
+func importParameters(l BackpropagationLayer, weights, biases *jsonMatrix) error {
+	if weights != nil {
+		w, err := importMatrix(weights)
+		if err != nil {
+			return fmt.Errorf("invalid weights: %w", err)
+		}
+
+		l.SetWeights(w)
+	}
+
+	if biases != nil {
+		b, err := importMatrix(biases)
+		if err != nil {
+			return fmt.Errorf("invalid biases: %w", err)
+		}
+
+		l.SetBiases(b)
+	}
+
+	return nil
+}
+
+// checkParameters makes sure that loaded weights and biases of a layer fit its
+// size and the size of its input
+func checkParameters(l BackpropagationLayer, inputs int) error {
+	var rows, cols, biases int
+
+	switch t := l.(type) {
+	case *Layer:
+		if t.isInput {
+			return nil
+		}
+
+		rows, cols, biases = t.rows, inputs, t.rows
+	case *SimpleRNN:
+		rows, cols, biases = t.gates*t.rows, inputs+t.rows, t.gates*t.rows
+	case *LSTM:
+		rows, cols, biases = t.gates*t.rows, inputs+t.rows, t.gates*t.rows
+	case *GRU:
+		rows, cols, biases = t.gates*t.rows, inputs+t.rows, t.gates*t.rows
+	case *Embedding:
+		rows, cols = t.vocabulary, t.rows
+	case *MultiHeadAttention:
+		if t.heads <= 0 || inputs%t.heads != 0 {
+			return fmt.Errorf("%d dimensions cannot be split between %d heads", inputs, t.heads)
+		}
+
+		rows, cols, biases = 4*inputs, inputs, 4*inputs
+	default:
+		return nil
+	}
+
+	if err := checkDims("weights", l.Weights(), rows, cols); err != nil {
+		return err
+	}
+
+	if biases > 0 {
+		return checkDims("biases", l.Biases(), biases, 1)
 	}
 
 	return nil
 }
+
+func checkDims(kind string, m *mat.Dense, rows, cols int) error {
+	if m == nil {
+		return fmt.Errorf("%s are missing", kind)
+	}
+
+	if r, c := m.Dims(); r != rows || c != cols {
+		return fmt.Errorf("%s are %dx%d instead of %dx%d", kind, r, c, rows, cols)
+	}
+
+	return nil
+}
+
+func exportMatrix(m *mat.Dense) *jsonMatrix {
+	if m == nil {
+		return nil
+	}
+
+	r, c := m.Dims()
+
+	return &jsonMatrix{Rows: r, Cols: c, Data: mat.DenseCopyOf(m).RawMatrix().Data}
+}
+
+// importMatrix returns a matrix read from a file unless it is malformed
+func importMatrix(j *jsonMatrix) (*mat.Dense, error) {
+	if j.Rows <= 0 || j.Cols <= 0 || len(j.Data) != j.Rows*j.Cols {
+		return nil, fmt.Errorf("malformed %dx%d matrix of %d values", j.Rows, j.Cols, len(j.Data))
+	}
+
+	return mat.NewDense(j.Rows, j.Cols, j.Data), nil
+}
+
+func activationName(a Activation) (string, error) {
+	switch a.(type) {
+	case *Sigmoid, Sigmoid:
+		return "sigmoid", nil
+	case *Softmax, Softmax:
+		return "softmax", nil
+	case *Tanh, Tanh:
+		return "tanh", nil
+	case *Linear, Linear:
+		return "linear", nil
+	}
+
+	return "", fmt.Errorf("unsupported activation %T", a)
+}
+
+func newActivation(name string) (Activation, error) {
+	switch name {
+	case "sigmoid":
+		return NewSigmoid(), nil
+	case "softmax":
+		return NewSoftmax(), nil
+	case "tanh":
+		return NewTanh(), nil
+	case "linear":
+		return NewLinear(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported activation %q", name)
+}
+
+func exportSchedule(lr LearningRate) (*jsonSchedule, error) {
+	j := &jsonSchedule{}
+
+	switch t := lr.(type) {
+	case *FlatLearningRate:
+		j.Type, j.Rate = "flat", t.lr
+	case *CosineDecayLearningRate:
+		j.Type, j.Rate, j.Final = "cosine_decay", t.initial, t.final
+	case *CosineStepDecayLearningRate:
+		j.Type, j.Rate, j.Final = "cosine_step_decay", t.initial, t.final
+	case *StepDecayLearningRate:
+		j.Type, j.Rate, j.Factor, j.Every = "step_decay", t.initial, t.factor, t.every
+	case *ExponentialDecayLearningRate:
+		j.Type, j.Rate, j.Factor = "exponential_decay", t.initial, t.rate
+	case *PolynomialDecayLearningRate:
+		j.Type, j.Rate, j.Final, j.Power = "polynomial_decay", t.initial, t.final, t.power
+	case *PiecewiseConstantLearningRate:
+		j.Type, j.Boundaries, j.Values = "piecewise_constant", t.boundaries, t.values
+	case *SGDRLearningRate:
+		j.Type, j.Rate, j.Final, j.First, j.Multiplier = "sgdr", t.max, t.min, t.first, t.multiplier
+	case *OneCycleLearningRate:
+		j.Type, j.Rate, j.Fraction, j.Factor, j.FinalFactor = "one_cycle", t.options.MaxRate, t.options.Warmup, t.options.DivFactor, t.options.FinalDivFactor
+		j.MinMomentum, j.MaxMomentum = t.options.MinMomentum, t.options.MaxMomentum
+	case *ReduceLROnPlateau:
+		inner, err := exportSchedule(t.schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		j.Type, j.Schedule = "reduce_on_plateau", inner
+		j.Metric, j.Mode, j.MinDelta = t.monitor.Metric, t.monitor.Mode, t.monitor.MinDelta
+		j.Patience, j.Factor, j.Final, j.Scale, j.Wait = t.patience, t.factor, t.minRate, t.scale, t.wait
+
+		if t.monitor.seen {
+			j.Best = &t.monitor.best
+		}
+	case *Warmup:
+		inner, err := exportSchedule(t.schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		j.Type, j.Schedule = "warmup", inner
+		j.Steps, j.Epochs, j.Mode, j.StartFactor = t.options.Steps, t.options.Epochs, t.options.Mode, t.options.StartFactor
+	default:
+		return nil, fmt.Errorf("unsupported learning rate %T", lr)
+	}
+
+	return j, nil
+}
+
+func importSchedule(j *jsonSchedule) (LearningRate, error) {
+	switch j.Type {
+	case "flat":
+		return NewFlatLearningRate(j.Rate), nil
+	case "cosine_decay":
+		return NewCosineDecayLearningRate(j.Rate, j.Final), nil
+	case "cosine_step_decay":
+		return NewCosineStepDecayLearningRate(j.Rate, j.Final), nil
+	case "step_decay":
+		return imported(newStepDecayLearningRate(j.Rate, j.Factor, j.Every))
+	case "exponential_decay":
+		return NewExponentialDecayLearningRate(j.Rate, j.Factor), nil
+	case "polynomial_decay":
+		return NewPolynomialDecayLearningRate(j.Rate, j.Final, j.Power), nil
+	case "piecewise_constant":
+		return imported(newPiecewiseConstantLearningRate(j.Boundaries, j.Values))
+	case "sgdr":
+		return imported(newSGDRLearningRate(j.Rate, j.Final, j.First, j.Multiplier))
+	case "one_cycle":
+		return imported(newOneCycleLearningRate(OneCycleOptions{
+			MaxRate:        j.Rate,
+			Warmup:         j.Fraction,
+			DivFactor:      j.Factor,
+			FinalDivFactor: j.FinalFactor,
+			MinMomentum:    j.MinMomentum,
+			MaxMomentum:    j.MaxMomentum,
+		}))
+	case "reduce_on_plateau":
+		if j.Schedule == nil {
+			return nil, fmt.Errorf("reduce on plateau has no schedule")
+		}
+
+		inner, err := importSchedule(j.Schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := newReduceLROnPlateau(inner, ReduceLROnPlateauOptions{
+			Monitor:  Monitor{Metric: j.Metric, Mode: j.Mode, MinDelta: j.MinDelta},
+			Patience: j.Patience,
+			Factor:   j.Factor,
+			MinRate:  j.Final,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if j.Scale <= 0 || j.Scale > 1 || j.Wait < 0 {
+			return nil, fmt.Errorf("reduce on plateau has invalid scale %g or wait %d", j.Scale, j.Wait)
+		}
+
+		r.scale, r.wait = j.Scale, j.Wait
+
+		if j.Best != nil {
+			r.monitor.best, r.monitor.seen = *j.Best, true
+		}
+
+		return r, nil
+	case "warmup":
+		if j.Schedule == nil {
+			return nil, fmt.Errorf("warmup has no schedule")
+		}
+
+		inner, err := importSchedule(j.Schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		return imported(newWarmup(inner, WarmupOptions{
+			Steps:       j.Steps,
+			Epochs:      j.Epochs,
+			Mode:        j.Mode,
+			StartFactor: j.StartFactor,
+		}))
+	}
+
+	return nil, fmt.Errorf("unsupported learning rate type %q", j.Type)
+}
+
+// imported returns a schedule created from a checkpoint unless its values are
+// invalid
+func imported[T LearningRate](s T, err error) (LearningRate, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// exportOptimizer returns the optimizer of the network along with its state,
+// or nil for optimizers this package knows nothing about
+func exportOptimizer(n *Network) *jsonOptimizer {
+	j := &jsonOptimizer{}
+
+	switch t := n.optimizer.(type) {
+	case *SGD:
+		j.Type, j.Momentum, j.Nesterov = "sgd", t.momentum, t.nesterov
+	case *RMSProp:
+		j.Type, j.Rho, j.Epsilon = "rmsprop", t.rho, t.epsilon
+	case *Adagrad:
+		j.Type, j.Epsilon = "adagrad", t.epsilon
+	case *Adadelta:
+		j.Type, j.Rho, j.Epsilon = "adadelta", t.rho, t.epsilon
+	default:
+		return nil
+	}
+
+	s, ok := n.optimizer.(statefulOptimizer)
+	if !ok {
+		return j
+	}
+
+	for i, p := range n.parameters() {
+		rows, cols := p.Dims()
+
+		if state := s.state(p); state != nil {
+			if r, c := state[0].Dims(); r == rows && c == cols {
+				j.States = append(j.States, jsonOptimizerState{Parameter: i, Matrices: exportMatrices(state)})
+				continue
+			}
+		}
+
+		for r := range rows {
+			if state := s.state(p.Slice(r, r+1, 0, cols).(*mat.Dense)); state != nil {
+				row := r
+				j.States = append(j.States, jsonOptimizerState{Parameter: i, Row: &row, Matrices: exportMatrices(state)})
+			}
+		}
+	}
+
+	return j
+}
+
+func importOptimizer(n *Network, j *jsonOptimizer) (Optimizer, error) {
+	var o Optimizer
+	var err error
+
+	switch j.Type {
+	case "sgd":
+		o = NewSGD(j.Momentum, j.Nesterov)
+	case "rmsprop":
+		if err = validateOptimizer(j.Rho, j.Epsilon); err == nil {
+			o = NewRMSProp(j.Rho, j.Epsilon)
+		}
+	case "adagrad":
+		if err = validateOptimizer(0, j.Epsilon); err == nil {
+			o = NewAdagrad(j.Epsilon)
+		}
+	case "adadelta":
+		if err = validateOptimizer(j.Rho, j.Epsilon); err == nil {
+			o = NewAdadelta(j.Rho, j.Epsilon)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported optimizer type %q", j.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s optimizer: %w", j.Type, err)
+	}
+
+	s, ok := o.(statefulOptimizer)
+	if !ok {
+		return o, nil
+	}
+
+	parameters := n.parameters()
+
+	for _, js := range j.States {
+		if js.Parameter < 0 || js.Parameter >= len(parameters) {
+			return nil, fmt.Errorf("state refers to unknown parameter %d", js.Parameter)
+		}
+
+		p := parameters[js.Parameter]
+
+		if js.Row != nil {
+			rows, cols := p.Dims()
+
+			if *js.Row < 0 || *js.Row >= rows {
+				return nil, fmt.Errorf("state refers to unknown row %d of parameter %d", *js.Row, js.Parameter)
+			}
+
+			p = p.Slice(*js.Row, *js.Row+1, 0, cols).(*mat.Dense)
+		}
+
+		state := make([]*mat.Dense, len(js.Matrices))
+
+		for i, m := range js.Matrices {
+			if m == nil {
+				return nil, fmt.Errorf("state of parameter %d has a missing matrix", js.Parameter)
+			}
+
+			if state[i], err = importMatrix(m); err != nil {
+				return nil, fmt.Errorf("state of parameter %d has a %w", js.Parameter, err)
+			}
+		}
+
+		if err := s.setState(p, state); err != nil {
+			return nil, fmt.Errorf("invalid state of parameter %d: %w", js.Parameter, err)
+		}
+	}
+
+	return o, nil
+}
+
+func exportMatrices(matrices []*mat.Dense) []*jsonMatrix {
+	j := make([]*jsonMatrix, len(matrices))
+
+	for i, m := range matrices {
+		j[i] = exportMatrix(m)
+	}
+
+	return j
+}
@@ -0,0 +1,153 @@
+package deeper
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// checkpointRoundTrip saves a checkpoint of n and loads it into a new network
+func checkpointRoundTrip(t *testing.T, n *Network, c Checkpoint) (*Network, Checkpoint) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewCheckpointer().SaveCheckpoint(&buf, n, c); err != nil {
+		t.Fatal(err)
+	}
+	m := NewNetwork()
+	loaded, err := NewCheckpointer().LoadCheckpoint(m, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, loaded
+}
+
+func TestCheckpointSchedules(t *testing.T) {
+	n := newLinearNet()
+
+	for _, lr := range []LearningRate{
+		NewFlatLearningRate(0.1),
+		NewCosineDecayLearningRate(0.1, 0.01),
+		NewStepDecayLearningRate(0.1, 0.5, 2),
+		NewExponentialDecayLearningRate(0.1, 0.9),
+		NewPolynomialDecayLearningRate(0.1, 0.01, 2),
+		NewPiecewiseConstantLearningRate([]int{2, 4}, []float64{0.1, 0.05, 0.01}),
+		NewWarmup(NewCosineDecayLearningRate(0.1, 0.01), WarmupOptions{Epochs: 2, Mode: WarmupExponential}),
+	} {
+		m, c := checkpointRoundTrip(t, n, Checkpoint{Epoch: 3, LearningRate: lr})
+		if c.Epoch != 3 || len(m.Layers) != 2 {
+			t.Fatalf("%T: checkpoint of epoch %d with %d layers", lr, c.Epoch, len(m.Layers))
+		}
+		assertRates(t, epochRates(c.LearningRate, 6), epochRates(lr, 6))
+	}
+}
+
+func TestLoadCheckpointWithoutCheckpoint(t *testing.T) {
+	n := newLinearNet()
+	var buf bytes.Buffer
+	if err := NewExporter().Save(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCheckpointer().LoadCheckpoint(NewNetwork(), &buf); err == nil {
+		t.Fatal("network without checkpoint is loaded as a checkpoint")
+	}
+}
+
+// assertInvalidSchedules fails unless every schedule is rejected on import
+func assertInvalidSchedules(t *testing.T, schedules ...string) {
+	t.Helper()
+	for _, s := range schedules {
+		var j jsonSchedule
+		if err := json.Unmarshal([]byte(s), &j); err != nil {
+			t.Fatal(err)
+		}
+		if lr, err := importSchedule(&j); err == nil || lr != nil {
+			t.Errorf("%s is imported as %v", s, lr)
+		}
+	}
+}
+
+func TestImportInvalidSchedules(t *testing.T) {
+	assertInvalidSchedules(t,
+		`{"type":"unknown"}`,
+		`{"type":"step_decay","rate":0.1}`,
+		`{"type":"piecewise_constant","values":[1,2]}`,
+		`{"type":"piecewise_constant","boundaries":[2,1],"values":[1,2,3]}`,
+		`{"type":"warmup","schedule":{"type":"flat"}}`,
+		`{"type":"warmup","epochs":2}`,
+		`{"type":"warmup","epochs":2,"schedule":{"type":"step_decay"}}`,
+	)
+}
+
+func TestSGDRCheckpoint(t *testing.T) {
+	j, err := exportSchedule(NewSGDRLearningRate(0.1, 0.001, 3, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"sgdr","rate":0.1,"final":0.001,"first":3,"multiplier":2}`; string(b) != want {
+		t.Fatalf("SGDR is exported as %s, want %s", b, want)
+	}
+
+	var k jsonSchedule
+	if err := json.Unmarshal(b, &k); err != nil {
+		t.Fatal(err)
+	}
+	s, err := importSchedule(&k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *s.(*SGDRLearningRate) != (SGDRLearningRate{max: 0.1, min: 0.001, first: 3, multiplier: 2}) {
+		t.Fatalf("SGDR is imported as %+v", s)
+	}
+
+	assertInvalidSchedules(t, `{"type":"sgdr","rate":0.1}`, `{"type":"sgdr","rate":0.1,"first":2}`)
+}
+
+func TestOneCycleCheckpoint(t *testing.T) {
+	s := NewOneCycleLearningRate(OneCycleOptions{MaxRate: 0.5, Warmup: 0.2, MinMomentum: 0.8, MaxMomentum: 0.9})
+	j, err := exportSchedule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := importSchedule(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *s2.(*OneCycleLearningRate) != *s.(*OneCycleLearningRate) {
+		t.Fatalf("one-cycle is imported as %+v", s2)
+	}
+
+	assertInvalidSchedules(t, `{"type":"one_cycle"}`, `{"type":"one_cycle","rate":1,"fraction":2}`)
+}
+
+func TestReduceLROnPlateauCheckpoint(t *testing.T) {
+	n := NewNetwork()
+	n.SetVerbosity(VerbosityQuiet)
+	s := NewReduceLROnPlateau(NewFlatLearningRate(0.1), ReduceLROnPlateauOptions{Monitor: Monitor{Metric: "val_loss"}, Patience: 1, Factor: 0.5})
+	for epoch, loss := range []float64{1, 2, 0.5, 3} {
+		s.LearningRate(4, epoch+1)
+		s.(EvaluationSchedule).AfterEvaluation(n, epoch+1, epochLog("val_loss", loss))
+	}
+
+	j, err := exportSchedule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := importSchedule(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := s.(*ReduceLROnPlateau), s2.(*ReduceLROnPlateau)
+	if a.scale != 0.25 || a.scale != b.scale || a.wait != b.wait || *a.monitor != *b.monitor {
+		t.Fatalf("%+v is imported as %+v", a, b)
+	}
+
+	assertInvalidSchedules(t,
+		`{"type":"reduce_on_plateau","factor":0.5,"scale":1}`,
+		`{"type":"reduce_on_plateau","schedule":{"type":"flat"},"factor":0.5}`,
+		`{"type":"reduce_on_plateau","schedule":{"type":"flat"},"factor":0.5,"scale":1,"wait":-1}`,
+	)
+}
@@ -0,0 +1,437 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Graph describes a model as a directed acyclic graph of layers. Unlike layers
+// added through Network.AddLayer, nodes of a graph may have several inputs
+// (i.e., residual connections summing outputs of two nodes, or concatenation
+// of several branches) and their outputs may be used by several other nodes.
+// Nodes can only be connected to nodes created before them, so the order of
+// creation is always a topological order of the graph.
+type Graph struct {
+	nodes       []*Node
+	inputs      []*Node
+	outputs     []*Node
+	outputNames []string
+	layers      map[BackpropagationLayer]bool
+}
+
+type Node struct {
+	id      int
+	graph   *Graph
+	rows    int
+	input   bool
+	name    string
+	index   int
+	layer   BackpropagationLayer
+	merge   merge
+	parents []*Node
+}
+
+// NewGraph creates an empty graph. Once built, it is passed to a network
+// through Network.SetGraph
+func NewGraph() *Graph {
+	return &Graph{
+		layers: make(map[BackpropagationLayer]bool),
+	}
+}
+
+// Rows returns the size of the node's output
+func (nd *Node) Rows() int {
+	return nd.rows
+}
+
+// Input adds an input node receiving samples of the given size. Graphs with
+// several inputs must use NamedInput instead
+func (g *Graph) Input(neurons int) *Node {
+	return g.NamedInput("", neurons)
+}
+
+// NamedInput adds an input node receiving samples of the given size from the
+// set of the same name in FitOptions.TrainInputs, FitOptions.ValInputs and
+// Network.EvaluateNamed
+func (g *Graph) NamedInput(name string, neurons int) *Node {
+	nd := g.add(&Node{rows: neurons, input: true, name: name, index: len(g.inputs)})
+	g.inputs = append(g.inputs, nd)
+
+	return nd
+}
+
+// Layer adds a node passing the output of the input node through the layer.
+// Weights of the layer are initialized if it has none. A layer may be used
+// only once within a graph.
+func (g *Graph) Layer(l BackpropagationLayer, input *Node) *Node {
+	g.check(input)
+
+	if l.IsInput() {
+		log.Fatalln(fmt.Errorf("input layers cannot be added to a graph, use Graph.Input instead"))
+	}
+
+	if g.layers[l] {
+		log.Fatalln(fmt.Errorf("layer %T is already a part of the graph", l))
+	}
+
+	g.layers[l] = true
+
+	l.SetInput(&port{node: input})
+	initParameters(l)
+
+	return g.add(&Node{rows: l.Rows(), layer: l, parents: []*Node{input}})
+}
+
+// Add adds a node summing outputs of nodes of the same size, which is how
+// residual (skip) connections are built
+func (g *Graph) Add(inputs ...*Node) *Node {
+	g.check(inputs...)
+
+	for _, in := range inputs {
+		if in.rows != inputs[0].rows {
+			log.Fatalln(fmt.Errorf("cannot add outputs of sizes %d and %d", inputs[0].rows, in.rows))
+		}
+	}
+
+	return g.add(&Node{rows: inputs[0].rows, merge: addMerge{}, parents: inputs})
+}
+
+// Concat adds a node concatenating outputs of nodes one under another (i.e.,
+// outputs of several towers of a model)
+func (g *Graph) Concat(inputs ...*Node) *Node {
+	g.check(inputs...)
+
+	rows := 0
+
+	for _, in := range inputs {
+		rows += in.rows
+	}
+
+	return g.add(&Node{rows: rows, merge: concatMerge{}, parents: inputs})
+}
+
+// Output marks the node as an output of the graph, which is compared with the
+// truth by the loss function. Graphs with several outputs must use NamedOutput
+// instead
+func (g *Graph) Output(output *Node) {
+	g.NamedOutput("", output)
+}
+
+// NamedOutput marks the node as an output of the graph (a head), which is
+// compared with targets of the same name in FitOptions.TrainTargets,
+// FitOptions.ValTargets and Network.EvaluateNamed by the loss function set
+// for this output with Network.SetOutputLoss
+func (g *Graph) NamedOutput(name string, output *Node) {
+	g.check(output)
+	g.outputs = append(g.outputs, output)
+	g.outputNames = append(g.outputNames, name)
+}
+
+func (g *Graph) add(nd *Node) *Node {
+	nd.id = len(g.nodes)
+	nd.graph = g
+	g.nodes = append(g.nodes, nd)
+
+	return nd
+}
+
+// check makes sure that nodes exist and belong to this graph
+func (g *Graph) check(nodes ...*Node) {
+	if len(nodes) == 0 {
+		log.Fatalln(fmt.Errorf("at least one node is expected"))
+	}
+
+	for _, nd := range nodes {
+		if nd == nil || nd.graph != g {
+			log.Fatalln(fmt.Errorf("node does not belong to the graph"))
+		}
+	}
+}
+
+// validate checks that the graph can be trained: it has inputs and outputs,
+// which are named unless there is only one of them, and every node contributes
+// to at least one output, so that every layer receives error during
+// backpropagation
+func (g *Graph) validate() error {
+	if len(g.inputs) == 0 || len(g.outputs) == 0 {
+		return fmt.Errorf("graph must have at least one input and one output")
+	}
+
+	inputNames := make([]string, len(g.inputs))
+
+	for i, in := range g.inputs {
+		inputNames[i] = in.name
+	}
+
+	if err := validateNames("input", inputNames); err != nil {
+		return err
+	}
+
+	if err := validateNames("output", g.outputNames); err != nil {
+		return err
+	}
+
+	used := make([]bool, len(g.nodes))
+
+	for _, o := range g.outputs {
+		used[o.id] = true
+	}
+
+	for i := len(g.nodes) - 1; i >= 0; i-- {
+		if used[i] {
+			for _, p := range g.nodes[i].parents {
+				used[p.id] = true
+			}
+		}
+	}
+
+	for i, u := range used {
+		if !u {
+			return fmt.Errorf("node %d does not contribute to any output", i)
+		}
+	}
+
+	return nil
+}
+
+func validateNames(kind string, names []string) error {
+	if len(names) == 1 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("every %s of a graph with several of them must be named", kind)
+		}
+
+		if seen[name] {
+			return fmt.Errorf("%s %q is defined twice", kind, name)
+		}
+
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// Layers returns layers of the graph in topological order
+func (g *Graph) Layers() []BackpropagationLayer {
+	layers := make([]BackpropagationLayer, 0, len(g.layers))
+
+	for _, nd := range g.nodes {
+		if nd.layer != nil {
+			layers = append(layers, nd.layer)
+		}
+	}
+
+	return layers
+}
+
+// graphPass holds everything a single sample leaves behind while passing
+// through a graph
+type graphPass struct {
+	// outputs of every node
+	outputs []*mat.Dense
+	// activations stacks of layer nodes, only for training
+	activations []*Stack
+}
+
+// feedforward passes inputs through all nodes in topological order. With
+// train set, activations of every layer are stored for backpropagation.
+func (g *Graph) feedforward(inputs []*mat.Dense, train bool) *graphPass {
+	p := &graphPass{outputs: make([]*mat.Dense, len(g.nodes))}
+
+	if train {
+		p.activations = make([]*Stack, len(g.nodes))
+	}
+
+	for i, nd := range g.nodes {
+		switch {
+		case nd.input:
+			p.outputs[i] = inputs[nd.index]
+		case nd.layer != nil:
+			var activations *Stack
+			x := p.outputs[nd.parents[0].id]
+
+			if train {
+				// The layer finds its input right under its own activations
+				activations = NewStack(2)
+				activations.Push(x)
+				p.activations[i] = activations
+			}
+
+			p.outputs[i] = nd.layer.Feedforward(x, activations)
+		default:
+			p.outputs[i] = nd.merge.forward(g.parentOutputs(nd, p))
+		}
+	}
+
+	return p
+}
+
+// backpropagation passes errors of outputs through all nodes in reverse
+// topological order. Errors of nodes used by several other nodes are summed.
+// As layers are visited in reverse order, their updates are popped from the
+// deltaWs and deltaBs stacks in the same order as Layers returns them.
+func (g *Graph) backpropagation(p *graphPass, deltas []*mat.Dense, deltaWs, deltaBs *Stack) {
+	errors := make([]*mat.Dense, len(g.nodes))
+
+	for i, o := range g.outputs {
+		accumulate(errors, o.id, deltas[i])
+	}
+
+	for i := len(g.nodes) - 1; i >= 0; i-- {
+		nd := g.nodes[i]
+
+		switch {
+		case nd.input:
+			continue
+		case nd.layer != nil:
+			nd.layer.Backpropagation(errors[i], p.activations[i], deltaWs, deltaBs)
+
+			// The port of the layer leaves error for the input on top
+			if delta := p.activations[i].Pop(); delta != nil {
+				accumulate(errors, nd.parents[0].id, delta)
+			}
+		default:
+			for j, delta := range nd.merge.backward(errors[i], g.parentOutputs(nd, p)) {
+				accumulate(errors, nd.parents[j].id, delta)
+			}
+		}
+	}
+}
+
+func (g *Graph) parentOutputs(nd *Node, p *graphPass) []*mat.Dense {
+	xs := make([]*mat.Dense, len(nd.parents))
+
+	for j, parent := range nd.parents {
+		xs[j] = p.outputs[parent.id]
+	}
+
+	return xs
+}
+
+// accumulate adds error to the error of a node. Layers may change errors they
+// receive, so every node gets its own copy
+func accumulate(errors []*mat.Dense, id int, delta *mat.Dense) {
+	if errors[id] == nil {
+		errors[id] = mat.DenseCopyOf(delta)
+	} else {
+		errors[id].Add(errors[id], delta)
+	}
+}
+
+// merge combines outputs of several nodes into one
+type merge interface {
+	forward(xs []*mat.Dense) *mat.Dense
+	backward(delta *mat.Dense, xs []*mat.Dense) []*mat.Dense
+}
+
+type addMerge struct{}
+
+func (addMerge) forward(xs []*mat.Dense) *mat.Dense {
+	y := mat.DenseCopyOf(xs[0])
+
+	for _, x := range xs[1:] {
+		y.Add(y, x)
+	}
+
+	return y
+}
+
+// backward passes the same error to every summand
+func (addMerge) backward(delta *mat.Dense, xs []*mat.Dense) []*mat.Dense {
+	deltas := make([]*mat.Dense, len(xs))
+
+	for i := range xs {
+		deltas[i] = delta
+	}
+
+	return deltas
+}
+
+type concatMerge struct{}
+
+func (concatMerge) forward(xs []*mat.Dense) *mat.Dense {
+	y := mat.DenseCopyOf(xs[0])
+
+	for _, x := range xs[1:] {
+		tmp := &mat.Dense{}
+		tmp.Stack(y, x)
+		y = tmp
+	}
+
+	return y
+}
+
+// backward splits error between inputs by their sizes
+func (concatMerge) backward(delta *mat.Dense, xs []*mat.Dense) []*mat.Dense {
+	deltas := make([]*mat.Dense, len(xs))
+	_, cols := delta.Dims()
+	from := 0
+
+	for i, x := range xs {
+		rows, _ := x.Dims()
+		deltas[i] = mat.DenseCopyOf(delta.Slice(from, from+rows, 0, cols))
+		from += rows
+	}
+
+	return deltas
+}
+
+// port connects a layer to a node of a graph. Layers treat it as their input
+// layer: it reports the size of the node's output, and during backpropagation
+// it leaves error with respect to this output on top of the activations stack.
+// Graph inputs have no use for errors, so ports of input nodes pretend to be
+// input layers, which saves layers from computing them.
+type port struct {
+	node *Node
+}
+
+func (p *port) Rows() int {
+	return p.node.rows
+}
+
+func (p *port) Cols() int {
+	return 1
+}
+
+func (p *port) IsInput() bool {
+	return p.node.input
+}
+
+func (p *port) IsOutput() bool {
+	return false
+}
+
+func (p *port) Weights() *mat.Dense {
+	return nil
+}
+
+func (p *port) Biases() *mat.Dense {
+	return nil
+}
+
+func (p *port) SetWeights(_ *mat.Dense) {
+}
+
+func (p *port) SetBiases(_ *mat.Dense) {
+}
+
+func (p *port) SetInput(_ BackpropagationLayer) {
+}
+
+func (p *port) SetOutput(_ BackpropagationLayer) {
+}
+
+func (p *port) Feedforward(x *mat.Dense, _ *Stack) *mat.Dense {
+	return x
+}
+
+func (p *port) Backpropagation(delta *mat.Dense, activations, _, _ *Stack) {
+	activations.Push(delta)
+}
@@ -0,0 +1,181 @@
+package deeper
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGraphGradients(t *testing.T) {
+	g := NewGraph()
+	in := g.Input(4)
+	h1 := g.Layer(NewHiddenLayer(5, NewSigmoid()), in)
+	h2 := g.Layer(NewHiddenLayer(5, NewTanh()), h1)
+	branch := g.Layer(NewHiddenLayer(3, NewSigmoid()), in)
+	// h1 feeds the residual addition, the concatenation and h2
+	c := g.Concat(g.Add(h1, h2), branch, h1)
+	g.Output(g.Layer(NewOutputLayer(2, identity{}), c))
+
+	n := NewNetwork()
+	n.SetGraph(g)
+	gradCheck(t, n, rnd(4, 1), rnd(2, 1))
+}
+
+func TestGraphSequenceGradients(t *testing.T) {
+	g := NewGraph()
+	e := g.Layer(NewEmbedding(10, 8), g.Input(1))
+	p := g.Layer(NewPositionalEncoding(), e)
+	a := g.Layer(NewMultiHeadAttention(2, false), p)
+	pool := g.Layer(NewGlobalAveragePooling(), g.Add(p, a))
+	g.Output(g.Layer(NewOutputLayer(2, identity{}), pool))
+
+	n := NewNetwork()
+	n.SetGraph(g)
+	gradCheck(t, n, mat.NewDense(1, 4, []float64{3, 7, 3, 1}), rnd(2, 1))
+}
+
+func TestGraphExport(t *testing.T) {
+	g := NewGraph()
+	in := g.Input(1)
+	p := g.Layer(NewPositionalEncoding(), g.Layer(NewEmbedding(10, 8), in))
+	s := g.Add(p, g.Layer(NewMultiHeadAttention(2, false), p))
+	g.Output(g.Layer(NewOutputLayer(2, NewSoftmax()), g.Layer(NewGlobalAveragePooling(), s)))
+
+	n := NewNetwork()
+	n.SetGraph(g)
+	n.SetOptimizer(NewSGD(0.9, true))
+	n.SetLossFunction(NewCategoricalCrossEntropy(ReductionMean))
+	n.SetVerbosity(VerbosityQuiet)
+	tx, ty := tokenData(200)
+	n.Fit(FitOptions{TrainX: tx, TrainY: ty, ValX: tx, ValY: ty, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+	assertSamePredictions(t, n, roundTrip(t, n), tx)
+}
+
+func TestLoadMalformedGraphs(t *testing.T) {
+	layer := `{"type":"hidden","neurons":2,"activation":"tanh","weights":{"rows":2,"cols":2,"data":[1,2,3,4]},"biases":{"rows":2,"cols":1,"data":[0,0]}}`
+	input := `{"type":"input","neurons":2}`
+	valid := `{"layers":[` + layer + `],"nodes":[` + input + `,{"type":"layer","parents":[0]}],"outputs":[1]}`
+	if err := NewExporter().Load(NewNetwork(), strings.NewReader(valid)); err != nil {
+		t.Fatal(err)
+	}
+
+	assertInvalidNetworks(t,
+		// a missing parent
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[2]}],"outputs":[1]}`,
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer"}],"outputs":[1]}`,
+		// a reused layer
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[0]},{"type":"layer","parents":[1]}],"outputs":[2]}`,
+		// an unused layer
+		`{"layers":[`+layer+`,`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[0]}],"outputs":[1]}`,
+		// a layer of another size of input
+		`{"layers":[`+layer+`],"nodes":[{"type":"input","neurons":3},{"type":"layer","parents":[0]}],"outputs":[1]}`,
+		// mismatched sizes of addition
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"input","name":"b","neurons":3},{"type":"add","parents":[0,1]},{"type":"layer","parents":[2]}],"outputs":[3]}`,
+		// an unused node
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[0]},{"type":"concat","parents":[0,1]}],"outputs":[1]}`,
+		// duplicate names
+		`{"layers":[`+layer+`],"nodes":[{"type":"input","name":"a","neurons":2},{"type":"input","name":"a","neurons":2},{"type":"add","parents":[0,1]},{"type":"layer","parents":[2]}],"outputs":[3]}`,
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[0]}],"outputs":[1,1],"output_names":["a","a"]}`,
+		// no outputs
+		`{"layers":[`+layer+`],"nodes":[`+input+`,{"type":"layer","parents":[0]}]}`,
+	)
+}
+
+// multiData returns samples of two inputs, where output "sa" depends on input
+// "a" and output "sb" depends on both inputs
+func multiData(k int) (map[string][]*mat.Dense, map[string][]*mat.Dense) {
+	inputs := map[string][]*mat.Dense{}
+	targets := map[string][]*mat.Dense{}
+	for range k {
+		a, b := rnd(2, 1), rnd(2, 1)
+		ya, yb := mat.NewDense(2, 1, nil), mat.NewDense(3, 1, nil)
+		if a.At(0, 0) > 0 {
+			ya.Set(1, 0, 1)
+		} else {
+			ya.Set(0, 0, 1)
+		}
+		switch s := b.At(0, 0) + a.At(1, 0); {
+		case s > 0.5:
+			yb.Set(2, 0, 1)
+		case s > -0.5:
+			yb.Set(1, 0, 1)
+		default:
+			yb.Set(0, 0, 1)
+		}
+		inputs["a"] = append(inputs["a"], a)
+		inputs["b"] = append(inputs["b"], b)
+		targets["sa"] = append(targets["sa"], ya)
+		targets["sb"] = append(targets["sb"], yb)
+	}
+	return inputs, targets
+}
+
+func TestMultiOutputGradients(t *testing.T) {
+	g := NewGraph()
+	a := g.NamedInput("a", 2)
+	b := g.NamedInput("b", 3)
+	h := g.Layer(NewHiddenLayer(4, NewSigmoid()), g.Concat(a, b))
+	g.NamedOutput("sa", g.Layer(NewOutputLayer(2, identity{}), h))
+	g.NamedOutput("sb", g.Layer(NewOutputLayer(3, identity{}), g.Add(h, g.Layer(NewHiddenLayer(4, NewTanh()), b))))
+
+	n := NewNetwork()
+	n.SetGraph(g)
+	n.SetOutputLoss("sa", halfSquaredError{}, 1)
+	n.SetOutputLoss("sb", halfSquaredError{}, 0.3)
+	heads, err := n.heads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := sample{x: []*mat.Dense{rnd(2, 1), rnd(3, 1)}, y: []*mat.Dense{rnd(2, 1), rnd(3, 1)}}
+	loss := func() float64 {
+		p := n.predict(s.x)
+		return heads[0].loss.Loss(p[0], s.y[0]) + 0.3*heads[1].loss.Loss(p[1], s.y[1])
+	}
+
+	dWs, dBs, _ := n.computeDeltas(s, heads)
+	for _, l := range n.trainable() {
+		dw, db := dWs.Pop(), dBs.Pop()
+		for _, pair := range []struct{ p, g *mat.Dense }{{l.Weights(), dw}, {l.Biases(), db}} {
+			for i, num := range numericalGradient(pair.p, loss) {
+				if e := math.Abs(num - pair.g.RawMatrix().Data[i]); e > 1e-5 {
+					t.Fatalf("%T: gradient %d differs by %g", l, i, e)
+				}
+			}
+		}
+	}
+}
+
+func TestMultiOutputFit(t *testing.T) {
+	g := NewGraph()
+	a := g.NamedInput("a", 2)
+	b := g.NamedInput("b", 2)
+	h := g.Layer(NewHiddenLayer(16, NewTanh()), g.Concat(a, b))
+	g.NamedOutput("sa", g.Layer(NewOutputLayer(2, NewSoftmax()), h))
+	g.NamedOutput("sb", g.Layer(NewOutputLayer(3, NewSoftmax()), h))
+
+	n := NewNetwork()
+	n.SetGraph(g)
+	n.SetOptimizer(NewSGD(0.9, false))
+	n.SetOutputLoss("sa", NewCategoricalCrossEntropy(ReductionMean), 1)
+	n.SetOutputLoss("sb", NewCategoricalCrossEntropy(ReductionMean), 0.5)
+	n.AddOutputMetric("sb", NewTopKAccuracy(2))
+	n.SetVerbosity(VerbosityQuiet)
+
+	ti, tt := multiData(2000)
+	vi, vt := multiData(300)
+	ev := n.Fit(FitOptions{TrainInputs: ti, TrainTargets: tt, ValInputs: vi, ValTargets: vt, Epochs: 5, BatchSize: 16, LearningRate: NewFlatLearningRate(1)}).Evaluation
+	if acc := ev.Outputs["sa"].Accuracy; acc < 0.9 {
+		t.Fatalf("accuracy of sa is %v", acc)
+	}
+	if _, ok := ev.Metric("val_top2_acc[sb]"); !ok {
+		t.Fatalf("no top-2 accuracy of sb in %v", ev.Metrics)
+	}
+
+	m := roundTrip(t, n)
+	if ev2 := m.EvaluateNamed(vi, vt); ev2.Accuracy != ev.Accuracy {
+		t.Fatalf("accuracy changed from %v to %v after export", ev.Accuracy, ev2.Accuracy)
+	}
+}
@@ -0,0 +1,125 @@
+package deeper
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// halfSquaredError is a plain summed loss used by gradient checks, so that
+// numerical gradients are not affected by reductions of the library losses
+type halfSquaredError struct{}
+
+func (halfSquaredError) Reset()             {}
+func (halfSquaredError) Result(int) float64 { return 0 }
+
+func (halfSquaredError) Loss(p, t *mat.Dense) float64 {
+	s := 0.0
+	for i, v := range p.RawMatrix().Data {
+		d := v - t.RawMatrix().Data[i]
+		s += 0.5 * d * d
+	}
+	return s
+}
+
+func (halfSquaredError) Derivative(p, t *mat.Dense) *mat.Dense {
+	r, c := p.Dims()
+	d := mat.NewDense(r, c, nil)
+	d.Sub(p, t)
+	return d
+}
+
+// identity keeps outputs of the last layer untouched in gradient checks
+type identity struct{}
+
+func (identity) Activation(m *mat.Dense) *mat.Dense { return mat.DenseCopyOf(m) }
+
+func (identity) Derivative(m *mat.Dense) *mat.Dense {
+	r, c := m.Dims()
+	d := mat.NewDense(r, c, nil)
+	for i := range r {
+		for j := range c {
+			d.Set(i, j, 1)
+		}
+	}
+	return d
+}
+
+// rnd returns a matrix of normally distributed values
+func rnd(r, c int) *mat.Dense {
+	d := make([]float64, r*c)
+	for i := range d {
+		d[i] = rand.NormFloat64() * 0.5
+	}
+	return mat.NewDense(r, c, d)
+}
+
+func deltasOf(n *Network, x, y *mat.Dense) (*Stack, *Stack) {
+	heads, _ := n.heads()
+	dWs, dBs, _ := n.computeDeltas(sample{x: []*mat.Dense{x}, y: []*mat.Dense{y}}, heads)
+	return dWs, dBs
+}
+
+func forwardOf(n *Network, x *mat.Dense) *mat.Dense {
+	return n.predict([]*mat.Dense{x})[0]
+}
+
+// numericalGradient perturbs every value of p and returns central
+// differences of f
+func numericalGradient(p *mat.Dense, f func() float64) []float64 {
+	data := p.RawMatrix().Data
+	g := make([]float64, len(data))
+
+	for i := range data {
+		old := data[i]
+		data[i] = old + 1e-5
+		plus := f()
+		data[i] = old - 1e-5
+		minus := f()
+		data[i] = old
+		g[i] = (plus - minus) / 2e-5
+	}
+
+	return g
+}
+
+// scatter sums sparse updates of rows into a matrix shaped like p
+func scatter(m *mat.Dense, rows []int, p *mat.Dense) *mat.Dense {
+	r, c := p.Dims()
+	full := mat.NewDense(r, c, nil)
+	for i, row := range rows {
+		for j := range c {
+			full.Set(row, j, full.At(row, j)+m.At(i, j))
+		}
+	}
+	return full
+}
+
+// gradCheck compares gradients of weights and biases of all trainable layers
+// with numerical ones
+func gradCheck(t *testing.T, n *Network, x, y *mat.Dense) {
+	t.Helper()
+	n.loss = halfSquaredError{}
+	dWs, dBs := deltasOf(n, x, y)
+	loss := func() float64 { return n.loss.Loss(forwardOf(n, x), y) }
+
+	for _, l := range n.trainable() {
+		dw, rows := dWs.PopSparse()
+		db := dBs.Pop()
+		if rows != nil {
+			dw = scatter(dw, rows, l.Weights())
+		}
+		for _, pair := range []struct{ p, g *mat.Dense }{{l.Weights(), dw}, {l.Biases(), db}} {
+			if pair.g == nil {
+				continue
+			}
+			for i, num := range numericalGradient(pair.p, loss) {
+				if e := math.Abs(num - pair.g.RawMatrix().Data[i]); e > 1e-5 {
+					t.Fatalf("%T: gradient %d differs by %g", l, i, e)
+				}
+			}
+		}
+	}
+}
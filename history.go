@@ -0,0 +1,153 @@
+package deeper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// EpochLog holds results of a single epoch
+type EpochLog struct {
+	Epoch        int
+	LearningRate float64
+	// Duration of training within the epoch, without validation
+	Duration time.Duration
+	// Metrics holds training loss, validation results and results of metrics
+	// by their names in the epoch log (see Evaluation.Metric)
+	Metrics map[string]float64
+}
+
+// History holds results of every epoch of a training session
+type History struct {
+	Epochs []EpochLog
+	// Evaluation is the evaluation of the last epoch
+	Evaluation Evaluation
+}
+
+// Metric returns values of a metric for every epoch, i.e., for plotting of
+// learning curves. Epochs without the metric have NaN
+func (h *History) Metric(name string) []float64 {
+	values := make([]float64, len(h.Epochs))
+
+	for i, e := range h.Epochs {
+		if v, ok := e.Metrics[name]; ok {
+			values[i] = v
+		} else {
+			values[i] = math.NaN()
+		}
+	}
+
+	return values
+}
+
+// EpochEndCallback is an optional interface of callbacks called with results
+// of every epoch before AfterEpoch
+type EpochEndCallback interface {
+	OnEpochEnd(n *Network, e EpochLog)
+}
+
+func (n *Network) onEpochEnd(e EpochLog) {
+	for _, c := range n.callbacks {
+		if cb, ok := c.(EpochEndCallback); ok {
+			cb.OnEpochEnd(n, e)
+		}
+	}
+}
+
+type CSVLogger struct {
+	w       *csv.Writer
+	columns []string
+}
+
+// NewCSVLogger creates a Callback that writes results of every epoch to a
+// destination (i.e., a file) as CSV. Columns are epoch, lr, duration (in
+// seconds) and metrics of the first epoch sorted by name. This is
+// responsibility of the caller to close the writer
+func NewCSVLogger(dst io.Writer) Callback {
+	return &CSVLogger{w: csv.NewWriter(dst)}
+}
+
+func (l *CSVLogger) AfterEpoch(_ *Network, _ int, _ Evaluation) bool {
+	return true
+}
+
+func (l *CSVLogger) OnEpochEnd(n *Network, e EpochLog) {
+	if l.columns == nil {
+		l.columns = slices.Sorted(maps.Keys(e.Metrics))
+		l.write(n, append([]string{"epoch", "lr", "duration"}, l.columns...))
+	}
+
+	record := []string{
+		strconv.Itoa(e.Epoch),
+		strconv.FormatFloat(e.LearningRate, 'g', -1, 64),
+		strconv.FormatFloat(e.Duration.Seconds(), 'g', -1, 64),
+	}
+
+	for _, name := range l.columns {
+		v, ok := e.Metrics[name]
+
+		if ok {
+			record = append(record, strconv.FormatFloat(v, 'g', -1, 64))
+		} else {
+			record = append(record, "")
+		}
+	}
+
+	l.write(n, record)
+}
+
+// write writes a record and flushes it, so that the file can be read while
+// training goes on. Training is not interrupted by failed writes
+func (l *CSVLogger) write(n *Network, record []string) {
+	if err := l.w.Write(record); err != nil {
+		n.warn("could not write training log", err)
+		return
+	}
+
+	l.w.Flush()
+
+	if err := l.w.Error(); err != nil {
+		n.warn("could not write training log", err)
+	}
+}
+
+type JSONLinesLogger struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesLogger creates a Callback that writes results of every epoch to
+// a destination (i.e., a file) as a JSON object per line with epoch, lr,
+// duration (in seconds) and metrics. NaN values are written as null. This is
+// responsibility of the caller to close the writer
+func NewJSONLinesLogger(dst io.Writer) Callback {
+	return &JSONLinesLogger{enc: json.NewEncoder(dst)}
+}
+
+func (l *JSONLinesLogger) AfterEpoch(_ *Network, _ int, _ Evaluation) bool {
+	return true
+}
+
+func (l *JSONLinesLogger) OnEpochEnd(n *Network, e EpochLog) {
+	line := make(map[string]any, len(e.Metrics)+3)
+
+	for name, v := range e.Metrics {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			line[name] = nil
+		} else {
+			line[name] = v
+		}
+	}
+
+	line["epoch"] = e.Epoch
+	line["lr"] = e.LearningRate
+	line["duration"] = e.Duration.Seconds()
+
+	if err := l.enc.Encode(line); err != nil {
+		n.warn("could not write training log", err)
+	}
+}
@@ -0,0 +1,50 @@
+package deeper
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHistoryAndLoggers(t *testing.T) {
+	n := newLinearNet()
+	var c, j bytes.Buffer
+	n.AddCallback(NewCSVLogger(&c))
+	n.AddCallback(NewJSONLinesLogger(&j))
+	x, y := regData(20)
+	h := n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 3, BatchSize: 8, LearningRate: NewFlatLearningRate(0.1)})
+
+	if len(h.Epochs) != 3 || h.Epochs[2].Epoch != 3 || h.Epochs[2].LearningRate != 0.1 {
+		t.Fatalf("history is %+v", h.Epochs)
+	}
+	losses := h.Metric("val_loss")
+	if len(losses) != 3 || losses[2] != h.Evaluation.Loss {
+		t.Fatalf("validation losses are %v, last evaluation has %v", losses, h.Evaluation.Loss)
+	}
+	if unknown := h.Metric("unknown"); !math.IsNaN(unknown[0]) {
+		t.Fatalf("unknown metric is %v", unknown)
+	}
+
+	records, err := csv.NewReader(&c).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || strings.Join(records[0][:3], ",") != "epoch,lr,duration" || records[3][0] != "3" {
+		t.Fatalf("CSV log is %v", records)
+	}
+
+	lines := strings.Split(strings.TrimSpace(j.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("JSON log has %d lines", len(lines))
+	}
+	var last map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last["epoch"] != 3.0 || last["val_loss"] != losses[2] {
+		t.Fatalf("last JSON line is %v", last)
+	}
+}
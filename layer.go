@@ -19,6 +19,14 @@ type BackpropagationLayer interface {
 	Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack)
 }
 
+// ParametersInitializer is implemented by layers whose weights and biases are
+// shaped differently from those of a fully connected layer. Network.AddLayer
+// delegates initialization to such layers once they are connected to their
+// input.
+type ParametersInitializer interface {
+	InitParameters(wi WeightInitializer)
+}
+
 type Layer struct {
 	WeightInitializer
 	id         int
@@ -131,7 +139,9 @@ func (l *Layer) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
 // the activation function's derivative on the output layer (Loss.Derivative).
 // On every layer we use output of the activation function stored in the
 // activation stack to get updates to weights and bias. These weight updates
-// placed in two stacks (deltaWs and deltaBs) for further subtraction.
+// placed in two stacks (deltaWs and deltaBs) for further subtraction. Every
+// layer passes the error with respect to its input (wᵀ * delta) to the previous
+// layer, so that layers do not need to know anything about their neighbours.
 func (l *Layer) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
 	if l.isInput {
 		return
@@ -140,19 +150,6 @@ func (l *Layer) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs
 	deltaW := mat.NewDense(l.weights.RawMatrix().Rows, l.input.Rows(), nil)
 	deltaB := mat.NewDense(l.biases.RawMatrix().Rows, 1, nil)
 
-	// On output layer we use error (delta), while on intermediate layers we
-	// use delta computed on previous step of the backpropagation process.
-	if !l.isOutput {
-		weightsT := l.output.Weights().T() // Transpose
-		rows, _ := weightsT.Dims()
-		cols := delta.RawMatrix().Cols
-
-		// wᵀ * delta
-		tmp := mat.NewDense(rows, cols, nil)
-		tmp.Mul(weightsT, delta)
-		delta = tmp
-	}
-
 	// delta ⊙ activation(x)' (Hadamard product)
 	delta.MulElem(delta, l.activation.Derivative(activations.Pop()))
 	deltaB.Copy(delta)
@@ -165,6 +162,19 @@ func (l *Layer) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs
 	deltaBs.Push(deltaB)
 
 	if l.input != nil {
-		l.input.Backpropagation(delta, activations, deltaWs, deltaBs)
+		var prev *mat.Dense
+
+		// There is nothing to pass to the input layer, as it has no weights
+		if !l.input.IsInput() {
+			weightsT := l.weights.T() // Transpose
+			rows, _ := weightsT.Dims()
+			cols := delta.RawMatrix().Cols
+
+			// wᵀ * delta
+			prev = mat.NewDense(rows, cols, nil)
+			prev.Mul(weightsT, delta)
+		}
+
+		l.input.Backpropagation(prev, activations, deltaWs, deltaBs)
 	}
 }
@@ -1,11 +1,63 @@
 package deeper
 
-import "math"
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+)
 
 type LearningRate interface {
 	LearningRate(epochs, epoch int) float64
 }
 
+// StepLearningRate is an optional interface of learning rate schedules that
+// change the rate within epochs (i.e., on every step). Fit still calls
+// LearningRate at the beginning of every epoch, then StepLearningRate before
+// every batch with the global step (counted from one across all epochs) and
+// the total number of steps. Schedules implementing only LearningRate keep
+// the same rate for the whole epoch.
+type StepLearningRate interface {
+	StepLearningRate(steps, step int) float64
+}
+
+// OptimizerSchedule is an optional interface of learning rate schedules that
+// also change hyperparameters of the optimizer (e.g., momentum) during
+// training. Fit calls ScheduleOptimizer before every batch with the same
+// steps as StepLearningRate.
+type OptimizerSchedule interface {
+	ScheduleOptimizer(o Optimizer, steps, step int)
+}
+
+// EvaluationSchedule is an optional interface of learning rate schedules that
+// adapt to results of training. Fit calls AfterEvaluation at the end of every
+// epoch with the same Evaluation callbacks receive.
+type EvaluationSchedule interface {
+	AfterEvaluation(n *Network, epoch int, ev Evaluation)
+}
+
+// wrapper is implemented by schedules changing the rate of another schedule
+type wrapper interface {
+	unwrap() LearningRate
+}
+
+// unwrapSchedule finds a schedule of type T among wrapped schedules
+func unwrapSchedule[T LearningRate](schedule LearningRate) (T, bool) {
+	for {
+		if t, ok := schedule.(T); ok {
+			return t, true
+		}
+
+		w, ok := schedule.(wrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+
+		schedule = w.unwrap()
+	}
+}
+
 type FlatLearningRate struct {
 	lr float64
 }
@@ -43,3 +95,603 @@ func (c *CosineDecayLearningRate) LearningRate(epochs, epoch int) float64 {
 		0.5*(c.initial-c.final)*
 			(1+math.Cos(math.Pi*float64(epoch)/float64(epochs)))
 }
+
+type CosineStepDecayLearningRate struct {
+	CosineDecayLearningRate
+}
+
+// NewCosineStepDecayLearningRate creates the cosine decay schedule, which
+// decays the learning rate on every step rather than once per epoch as
+// NewCosineDecayLearningRate does
+func NewCosineStepDecayLearningRate(initial, final float64) LearningRate {
+	return &CosineStepDecayLearningRate{
+		CosineDecayLearningRate{
+			initial: initial,
+			final:   final,
+		},
+	}
+}
+
+// StepLearningRate goes from the initial rate on the first step to the final
+// rate on the last one
+func (c *CosineStepDecayLearningRate) StepLearningRate(steps, step int) float64 {
+	if steps <= 1 {
+		return c.initial
+	}
+
+	return c.final +
+		0.5*(c.initial-c.final)*
+			(1+math.Cos(math.Pi*float64(step-1)/float64(steps-1)))
+}
+
+const (
+	WarmupLinear = iota
+	WarmupExponential
+)
+
+type WarmupOptions struct {
+	// Steps or Epochs is the length of warmup, only one of them may be set
+	Steps  int
+	Epochs int
+	// Mode is either WarmupLinear or WarmupExponential
+	Mode int
+	// StartFactor is the fraction of the learning rate warmup starts from.
+	// Linear warmup starts from zero by default, while exponential warmup
+	// starts from 0.01 of the learning rate
+	StartFactor float64
+}
+
+type Warmup struct {
+	schedule LearningRate
+	options  WarmupOptions
+	epoch    int
+	rate     float64
+}
+
+// NewWarmup wraps any learning rate schedule with warmup (Goyal et al.,
+// https://doi.org/10.48550/arXiv.1706.02677), which ramps the learning rate
+// up over the first steps or epochs of training, so that large learning rates
+// do not make training diverge early. Linear warmup grows the rate in equal
+// increments, while exponential one multiplies it by the same factor on every
+// step or epoch.
+func NewWarmup(schedule LearningRate, o WarmupOptions) LearningRate {
+	s, err := newWarmup(schedule, o)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newWarmup(schedule LearningRate, o WarmupOptions) (*Warmup, error) {
+	if (o.Steps > 0) == (o.Epochs > 0) {
+		return nil, fmt.Errorf("either warmup steps or epochs must be greater than zero")
+	}
+
+	if o.Mode != WarmupLinear && o.Mode != WarmupExponential {
+		return nil, fmt.Errorf("unknown warmup mode %d", o.Mode)
+	}
+
+	if o.Mode == WarmupExponential && o.StartFactor == 0 {
+		o.StartFactor = 0.01
+	}
+
+	if o.StartFactor < 0 || o.StartFactor >= 1 {
+		return nil, fmt.Errorf("warmup start factor must be in range [0, 1)")
+	}
+
+	return &Warmup{
+		schedule: schedule,
+		options:  o,
+	}, nil
+}
+
+// LearningRate returns the rate of the wrapped schedule, reduced during
+// warmup epochs
+func (w *Warmup) LearningRate(epochs, epoch int) float64 {
+	w.epoch = epoch
+	w.rate = w.schedule.LearningRate(epochs, epoch)
+
+	if w.options.Epochs > 0 {
+		return w.rate * w.factor(epoch, w.options.Epochs)
+	}
+
+	return w.rate
+}
+
+// StepLearningRate returns the rate of the wrapped schedule, reduced during
+// warmup steps or epochs. Schedules that change the rate within epochs are
+// asked for the rate of the step
+func (w *Warmup) StepLearningRate(steps, step int) float64 {
+	rate := w.rate
+
+	if s, ok := w.schedule.(StepLearningRate); ok {
+		rate = s.StepLearningRate(steps, step)
+	}
+
+	if w.options.Steps > 0 {
+		return rate * w.factor(step, w.options.Steps)
+	}
+
+	return rate * w.factor(w.epoch, w.options.Epochs)
+}
+
+// ScheduleOptimizer passes the optimizer to the wrapped schedule
+func (w *Warmup) ScheduleOptimizer(o Optimizer, steps, step int) {
+	if s, ok := w.schedule.(OptimizerSchedule); ok {
+		s.ScheduleOptimizer(o, steps, step)
+	}
+}
+
+// AfterEvaluation passes results of the epoch to the wrapped schedule
+func (w *Warmup) AfterEvaluation(n *Network, epoch int, ev Evaluation) {
+	if s, ok := w.schedule.(EvaluationSchedule); ok {
+		s.AfterEvaluation(n, epoch, ev)
+	}
+}
+
+func (w *Warmup) unwrap() LearningRate {
+	return w.schedule
+}
+
+// factor returns the fraction of the learning rate at step (or epoch) i of n
+func (w *Warmup) factor(i, n int) float64 {
+	if i >= n {
+		return 1
+	}
+
+	progress := float64(i) / float64(n)
+
+	if w.options.Mode == WarmupExponential {
+		return math.Pow(w.options.StartFactor, 1-progress)
+	}
+
+	return w.options.StartFactor + (1-w.options.StartFactor)*progress
+}
+
+type StepDecayLearningRate struct {
+	initial float64
+	factor  float64
+	every   int
+}
+
+// NewStepDecayLearningRate creates a schedule multiplying the initial learning
+// rate by factor every given number of epochs (i.e., 0.1 every 30 epochs)
+func NewStepDecayLearningRate(initial, factor float64, every int) LearningRate {
+	s, err := newStepDecayLearningRate(initial, factor, every)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newStepDecayLearningRate(initial, factor float64, every int) (*StepDecayLearningRate, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("step decay period must be greater than zero")
+	}
+
+	return &StepDecayLearningRate{
+		initial: initial,
+		factor:  factor,
+		every:   every,
+	}, nil
+}
+
+func (s *StepDecayLearningRate) LearningRate(_, epoch int) float64 {
+	return s.initial * math.Pow(s.factor, float64((epoch-1)/s.every))
+}
+
+type ExponentialDecayLearningRate struct {
+	initial float64
+	rate    float64
+}
+
+// NewExponentialDecayLearningRate creates a schedule multiplying the learning
+// rate by rate after every epoch
+func NewExponentialDecayLearningRate(initial, rate float64) LearningRate {
+	return &ExponentialDecayLearningRate{
+		initial: initial,
+		rate:    rate,
+	}
+}
+
+func (e *ExponentialDecayLearningRate) LearningRate(_, epoch int) float64 {
+	return e.initial * math.Pow(e.rate, float64(epoch-1))
+}
+
+type PolynomialDecayLearningRate struct {
+	initial float64
+	final   float64
+	power   float64
+}
+
+// NewPolynomialDecayLearningRate creates a schedule decaying the learning rate
+// from initial to final value as (initial - final) * (1 - t / T)^power + final
+// over the whole training. Power of 1 gives the linear decay
+func NewPolynomialDecayLearningRate(initial, final, power float64) LearningRate {
+	return &PolynomialDecayLearningRate{
+		initial: initial,
+		final:   final,
+		power:   power,
+	}
+}
+
+func (p *PolynomialDecayLearningRate) LearningRate(epochs, epoch int) float64 {
+	return p.decay(epochs, epoch)
+}
+
+// StepLearningRate decays the learning rate on every step
+func (p *PolynomialDecayLearningRate) StepLearningRate(steps, step int) float64 {
+	return p.decay(steps, step)
+}
+
+func (p *PolynomialDecayLearningRate) decay(n, i int) float64 {
+	if n <= 1 {
+		return p.initial
+	}
+
+	return (p.initial-p.final)*math.Pow(1-float64(i-1)/float64(n-1), p.power) + p.final
+}
+
+type PiecewiseConstantLearningRate struct {
+	boundaries []int
+	values     []float64
+}
+
+// NewPiecewiseConstantLearningRate creates a schedule with constant learning
+// rates between boundaries: values[0] up to epoch boundaries[0] inclusive,
+// values[1] up to epoch boundaries[1], and so on, with the last value after
+// the last boundary. Boundaries must be increasing, and there must be one
+// value more than boundaries
+func NewPiecewiseConstantLearningRate(boundaries []int, values []float64) LearningRate {
+	s, err := newPiecewiseConstantLearningRate(boundaries, values)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newPiecewiseConstantLearningRate(boundaries []int, values []float64) (*PiecewiseConstantLearningRate, error) {
+	if len(values) != len(boundaries)+1 {
+		return nil, fmt.Errorf("%d values expected for %d boundaries, got %d", len(boundaries)+1, len(boundaries), len(values))
+	}
+
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] <= boundaries[i-1] {
+			return nil, fmt.Errorf("boundaries must be increasing")
+		}
+	}
+
+	return &PiecewiseConstantLearningRate{
+		boundaries: boundaries,
+		values:     values,
+	}, nil
+}
+
+func (p *PiecewiseConstantLearningRate) LearningRate(_, epoch int) float64 {
+	for i, b := range p.boundaries {
+		if epoch <= b {
+			return p.values[i]
+		}
+	}
+
+	return p.values[len(p.values)-1]
+}
+
+type SGDRLearningRate struct {
+	max        float64
+	min        float64
+	first      int
+	multiplier int
+	epochs     int
+}
+
+// NewSGDRLearningRate creates the cosine annealing schedule with warm restarts
+// proposed by Loshchilov et al. (https://doi.org/10.48550/arXiv.1608.03983).
+// The learning rate decays from max to min over a cycle of first epochs, then
+// restarts from max with a cycle multiplier times longer than the previous one.
+// Within epochs, the rate decays on every step
+func NewSGDRLearningRate(max, min float64, first, multiplier int) LearningRate {
+	s, err := newSGDRLearningRate(max, min, first, multiplier)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newSGDRLearningRate(max, min float64, first, multiplier int) (*SGDRLearningRate, error) {
+	if first <= 0 || multiplier <= 0 {
+		return nil, fmt.Errorf("first cycle length and cycle multiplier must be greater than zero")
+	}
+
+	return &SGDRLearningRate{
+		max:        max,
+		min:        min,
+		first:      first,
+		multiplier: multiplier,
+	}, nil
+}
+
+func (s *SGDRLearningRate) LearningRate(epochs, epoch int) float64 {
+	s.epochs = epochs
+
+	return s.anneal(float64(epoch - 1))
+}
+
+// StepLearningRate anneals the learning rate with fractions of epochs passed
+func (s *SGDRLearningRate) StepLearningRate(steps, step int) float64 {
+	if s.epochs == 0 {
+		return s.max
+	}
+
+	return s.anneal(float64(step-1) / (float64(steps) / float64(s.epochs)))
+}
+
+// anneal computes the learning rate after t epochs since the beginning of
+// training
+func (s *SGDRLearningRate) anneal(t float64) float64 {
+	cycle := float64(s.first)
+
+	for t >= cycle {
+		t -= cycle
+		cycle *= float64(s.multiplier)
+	}
+
+	return s.min + 0.5*(s.max-s.min)*(1+math.Cos(math.Pi*t/cycle))
+}
+
+// Restart tells whether the epoch is the last one of a cycle, after which the
+// learning rate restarts. The number of this cycle, counting from one, is
+// returned as well
+func (s *SGDRLearningRate) Restart(epoch int) (int, bool) {
+	end, cycles := 0, 0
+
+	for cycle := s.first; end < epoch; cycle *= s.multiplier {
+		end += cycle
+		cycles++
+	}
+
+	return cycles, end == epoch
+}
+
+type OneCycleOptions struct {
+	// MaxRate is the peak learning rate reached at the end of the first phase
+	MaxRate float64
+	// Warmup is the fraction of steps over which the learning rate grows, 0.3
+	// by default
+	Warmup float64
+	// DivFactor sets the initial learning rate to MaxRate/DivFactor, 25 by
+	// default
+	DivFactor float64
+	// FinalDivFactor sets the final learning rate to the initial one divided
+	// by FinalDivFactor, 1e4 by default
+	FinalDivFactor float64
+	// MinMomentum and MaxMomentum are the bounds of momentum, which cycles
+	// inversely to the learning rate. They are 0.85 and 0.95 by default
+	MinMomentum float64
+	MaxMomentum float64
+}
+
+type OneCycleLearningRate struct {
+	options OneCycleOptions
+}
+
+// NewOneCycleLearningRate creates the one-cycle policy (Smith and Topin,
+// https://doi.org/10.48550/arXiv.1708.07120). The learning rate grows from
+// MaxRate/DivFactor to MaxRate, then anneals to a much smaller rate, both
+// following a cosine curve. Momentum of optimizers implementing
+// MomentumOptimizer goes the opposite way: from MaxMomentum down to
+// MinMomentum and back
+func NewOneCycleLearningRate(o OneCycleOptions) LearningRate {
+	s, err := newOneCycleLearningRate(o)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newOneCycleLearningRate(o OneCycleOptions) (*OneCycleLearningRate, error) {
+	if o.Warmup == 0 {
+		o.Warmup = 0.3
+	}
+
+	if o.DivFactor == 0 {
+		o.DivFactor = 25
+	}
+
+	if o.FinalDivFactor == 0 {
+		o.FinalDivFactor = 1e4
+	}
+
+	if o.MinMomentum == 0 && o.MaxMomentum == 0 {
+		o.MinMomentum, o.MaxMomentum = 0.85, 0.95
+	}
+
+	if o.MaxRate <= 0 {
+		return nil, fmt.Errorf("one-cycle max rate must be greater than zero")
+	}
+
+	if o.Warmup <= 0 || o.Warmup >= 1 {
+		return nil, fmt.Errorf("one-cycle warmup must be in range (0, 1)")
+	}
+
+	if o.DivFactor < 1 || o.FinalDivFactor < 1 {
+		return nil, fmt.Errorf("one-cycle division factors must not be less than one")
+	}
+
+	if o.MinMomentum < 0 || o.MinMomentum > o.MaxMomentum || o.MaxMomentum >= 1 {
+		return nil, fmt.Errorf("one-cycle momentum must satisfy 0 <= min <= max < 1")
+	}
+
+	return &OneCycleLearningRate{
+		options: o,
+	}, nil
+}
+
+func (c *OneCycleLearningRate) LearningRate(epochs, epoch int) float64 {
+	rate, _ := c.cycle(epochs, epoch)
+
+	return rate
+}
+
+func (c *OneCycleLearningRate) StepLearningRate(steps, step int) float64 {
+	rate, _ := c.cycle(steps, step)
+
+	return rate
+}
+
+// ScheduleOptimizer sets momentum of the optimizer for the step
+func (c *OneCycleLearningRate) ScheduleOptimizer(o Optimizer, steps, step int) {
+	if m, ok := o.(MomentumOptimizer); ok {
+		_, momentum := c.cycle(steps, step)
+		m.SetMomentum(momentum)
+	}
+}
+
+// cycle returns the learning rate and momentum at step i of n
+func (c *OneCycleLearningRate) cycle(n, i int) (float64, float64) {
+	initial := c.options.MaxRate / c.options.DivFactor
+	final := initial / c.options.FinalDivFactor
+	progress := 0.0
+
+	if n > 1 {
+		progress = float64(i-1) / float64(n-1)
+	}
+
+	anneal := func(from, to, p float64) float64 {
+		return to + 0.5*(from-to)*(1+math.Cos(math.Pi*p))
+	}
+
+	if progress < c.options.Warmup {
+		p := progress / c.options.Warmup
+
+		return anneal(initial, c.options.MaxRate, p), anneal(c.options.MaxMomentum, c.options.MinMomentum, p)
+	}
+
+	p := (progress - c.options.Warmup) / (1 - c.options.Warmup)
+
+	return anneal(c.options.MaxRate, final, p), anneal(c.options.MinMomentum, c.options.MaxMomentum, p)
+}
+
+type ReduceLROnPlateauOptions struct {
+	// Monitor is the quantity watched for improvements, "val_acc" by default
+	Monitor Monitor
+	// Patience is the number of epochs without improvement after which the
+	// learning rate is reduced
+	Patience int
+	// Factor multiplies the learning rate on every reduction, 0.1 by default
+	Factor float64
+	// MinRate is the floor the learning rate is never reduced below
+	MinRate float64
+}
+
+type ReduceLROnPlateau struct {
+	schedule LearningRate
+	monitor  *monitor
+	patience int
+	factor   float64
+	minRate  float64
+	scale    float64
+	wait     int
+	rate     float64 // the last rate of the wrapped schedule
+}
+
+// NewReduceLROnPlateau wraps any learning rate schedule and scales its rate
+// down by Factor every time the monitored quantity has not improved for
+// Patience epochs. Unlike other schedules, it depends on results of
+// validation, which Fit passes to it after every epoch (see
+// EvaluationSchedule)
+func NewReduceLROnPlateau(schedule LearningRate, o ReduceLROnPlateauOptions) LearningRate {
+	s, err := newReduceLROnPlateau(schedule, o)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return s
+}
+
+func newReduceLROnPlateau(schedule LearningRate, o ReduceLROnPlateauOptions) (*ReduceLROnPlateau, error) {
+	if o.Factor == 0 {
+		o.Factor = 0.1
+	}
+
+	if o.Factor <= 0 || o.Factor >= 1 {
+		return nil, fmt.Errorf("plateau factor must be in range (0, 1)")
+	}
+
+	if o.Patience < 0 || o.MinRate < 0 {
+		return nil, fmt.Errorf("plateau patience and min rate must not be negative")
+	}
+
+	return &ReduceLROnPlateau{
+		schedule: schedule,
+		monitor:  newMonitor(o.Monitor),
+		patience: o.Patience,
+		factor:   o.Factor,
+		minRate:  o.MinRate,
+		scale:    1,
+	}, nil
+}
+
+func (r *ReduceLROnPlateau) LearningRate(epochs, epoch int) float64 {
+	r.rate = r.schedule.LearningRate(epochs, epoch)
+
+	return r.reduce(r.rate)
+}
+
+func (r *ReduceLROnPlateau) StepLearningRate(steps, step int) float64 {
+	if s, ok := r.schedule.(StepLearningRate); ok {
+		r.rate = s.StepLearningRate(steps, step)
+	}
+
+	return r.reduce(r.rate)
+}
+
+// ScheduleOptimizer passes the optimizer to the wrapped schedule
+func (r *ReduceLROnPlateau) ScheduleOptimizer(o Optimizer, steps, step int) {
+	if s, ok := r.schedule.(OptimizerSchedule); ok {
+		s.ScheduleOptimizer(o, steps, step)
+	}
+}
+
+// AfterEvaluation counts epochs without improvement and reduces the learning
+// rate once there are Patience of them. Results are passed to the wrapped
+// schedule as well
+func (r *ReduceLROnPlateau) AfterEvaluation(n *Network, epoch int, ev Evaluation) {
+	if s, ok := r.schedule.(EvaluationSchedule); ok {
+		s.AfterEvaluation(n, epoch, ev)
+	}
+
+	if r.monitor.update(r.monitor.value(ev)) {
+		r.wait = 0
+		return
+	}
+
+	r.wait++
+
+	if r.wait < r.patience || r.reduce(r.rate) <= r.minRate {
+		return
+	}
+
+	r.scale *= r.factor
+	r.wait = 0
+
+	n.notice("learning rate reduced",
+		slog.Int("epoch", epoch),
+		slog.String("metric", r.monitor.Metric),
+		slog.Float64("lr", r.reduce(r.rate)),
+	)
+}
+
+func (r *ReduceLROnPlateau) unwrap() LearningRate {
+	return r.schedule
+}
+
+// reduce scales the rate of the wrapped schedule keeping it above the floor
+func (r *ReduceLROnPlateau) reduce(rate float64) float64 {
+	return max(rate*r.scale, r.minRate)
+}
@@ -0,0 +1,176 @@
+package deeper
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// assertRates fails unless rates match the expected ones
+func assertRates(t *testing.T, got, want []float64) {
+	t.Helper()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Fatalf("rates are %v, want %v", got, want)
+		}
+	}
+}
+
+// epochRates returns rates of every epoch of a schedule
+func epochRates(s LearningRate, epochs int) []float64 {
+	rates := make([]float64, epochs)
+	for i := range rates {
+		rates[i] = s.LearningRate(epochs, i+1)
+	}
+	return rates
+}
+
+func TestWarmupEpochs(t *testing.T) {
+	linear := NewWarmup(NewFlatLearningRate(0.1), WarmupOptions{Epochs: 4})
+	assertRates(t, epochRates(linear, 5), []float64{0.025, 0.05, 0.075, 0.1, 0.1})
+
+	exponential := NewWarmup(NewFlatLearningRate(0.1), WarmupOptions{Epochs: 2, Mode: WarmupExponential})
+	assertRates(t, epochRates(exponential, 3), []float64{0.01, 0.1, 0.1})
+
+	// the wrapped schedule keeps its own epochs
+	decay := NewWarmup(NewStepDecayLearningRate(0.1, 0.5, 1), WarmupOptions{Epochs: 2, StartFactor: 0.5})
+	assertRates(t, epochRates(decay, 3), []float64{0.75 * 0.1, 0.05, 0.025})
+}
+
+func TestWarmupOptions(t *testing.T) {
+	for _, o := range []WarmupOptions{
+		{},
+		{Steps: 2, Epochs: 2},
+		{Epochs: 2, StartFactor: 1},
+		{Epochs: 2, StartFactor: -0.1},
+		{Epochs: 2, Mode: WarmupExponential + 1},
+		{Epochs: 2, Mode: -1},
+	} {
+		if _, err := newWarmup(NewFlatLearningRate(0.1), o); err == nil {
+			t.Errorf("options %+v are accepted", o)
+		}
+	}
+}
+
+// stepRates returns rates of every step of a schedule
+func stepRates(s LearningRate, steps int) []float64 {
+	rates := make([]float64, steps)
+	for i := range rates {
+		rates[i] = s.(StepLearningRate).StepLearningRate(steps, i+1)
+	}
+	return rates
+}
+
+func TestCosineDecay(t *testing.T) {
+	epochs := NewCosineDecayLearningRate(0.1, 0.01)
+	if _, ok := epochs.(StepLearningRate); ok {
+		t.Fatal("cosine decay changes the rate within epochs")
+	}
+	assertRates(t, epochRates(epochs, 3), []float64{0.1, 0.0325, 0.01})
+
+	steps := NewCosineStepDecayLearningRate(0.1, 0.01)
+	assertRates(t, stepRates(steps, 5), []float64{0.1, 0.01 + 0.045*(1+math.Sqrt2/2), 0.055, 0.01 + 0.045*(1-math.Sqrt2/2), 0.01})
+}
+
+func TestWarmupSteps(t *testing.T) {
+	w := NewWarmup(NewFlatLearningRate(0.1), WarmupOptions{Steps: 4})
+	w.LearningRate(2, 1)
+	assertRates(t, stepRates(w, 6), []float64{0.025, 0.05, 0.075, 0.1, 0.1, 0.1})
+
+	// per-step schedules are warmed up on every step
+	c := NewWarmup(NewCosineStepDecayLearningRate(0.1, 0.01), WarmupOptions{Steps: 2})
+	c.LearningRate(1, 1)
+	assertRates(t, stepRates(c, 3), []float64{0.05, 0.055, 0.01})
+}
+
+func TestDecaySchedules(t *testing.T) {
+	for _, c := range []struct {
+		schedule LearningRate
+		rates    []float64
+	}{
+		{NewStepDecayLearningRate(0.1, 0.5, 2), []float64{0.1, 0.1, 0.05, 0.05, 0.025}},
+		{NewExponentialDecayLearningRate(0.1, 0.5), []float64{0.1, 0.05, 0.025, 0.0125, 0.00625}},
+		{NewPolynomialDecayLearningRate(0.1, 0.02, 1), []float64{0.1, 0.08, 0.06, 0.04, 0.02}},
+		{NewPolynomialDecayLearningRate(0.1, 0, 2), []float64{0.1, 0.05625, 0.025, 0.00625, 0}},
+		{NewPiecewiseConstantLearningRate([]int{1, 3}, []float64{0.1, 0.05, 0.01}), []float64{0.1, 0.05, 0.05, 0.01, 0.01}},
+	} {
+		assertRates(t, epochRates(c.schedule, 5), c.rates)
+	}
+}
+
+func TestSGDR(t *testing.T) {
+	s := NewSGDRLearningRate(0.1, 0, 2, 2).(*SGDRLearningRate)
+	quarter := 0.05 * (1 + math.Sqrt2/2)
+	assertRates(t, epochRates(s, 7), []float64{0.1, 0.05, 0.1, quarter, 0.05, 0.1 - quarter, 0.1})
+
+	var restarts, cycles []int
+	for epoch := 1; epoch <= 14; epoch++ {
+		if cycle, ok := s.Restart(epoch); ok {
+			restarts, cycles = append(restarts, epoch), append(cycles, cycle)
+		}
+	}
+	if fmt.Sprint(restarts) != "[2 6 14]" || fmt.Sprint(cycles) != "[1 2 3]" {
+		t.Fatalf("cycles %v end after epochs %v", cycles, restarts)
+	}
+
+	// the second step of an epoch of two steps is in the middle of the epoch
+	s.LearningRate(2, 1)
+	if r := s.StepLearningRate(4, 2); math.Abs(r-quarter) > 1e-12 {
+		t.Fatalf("rate of step 2 is %v", r)
+	}
+}
+
+func TestOneCycle(t *testing.T) {
+	s := NewOneCycleLearningRate(OneCycleOptions{MaxRate: 1, Warmup: 0.25})
+	final := 0.04 / 1e4
+	assertRates(t, stepRates(s, 5), []float64{0.04, 1, final + 0.75*(1-final), final + 0.25*(1-final), final})
+
+	sgd := NewSGD(0.9, false).(*SGD)
+	var momentum []float64
+	for _, step := range []int{1, 2, 5} {
+		s.(OptimizerSchedule).ScheduleOptimizer(sgd, 5, step)
+		momentum = append(momentum, sgd.momentum)
+	}
+	assertRates(t, momentum, []float64{0.95, 0.85, 0.95})
+
+	for _, o := range []OneCycleOptions{
+		{},
+		{MaxRate: 1, Warmup: 1},
+		{MaxRate: 1, DivFactor: 0.5},
+		{MaxRate: 1, MinMomentum: 0.9, MaxMomentum: 0.8},
+	} {
+		if _, err := newOneCycleLearningRate(o); err == nil {
+			t.Errorf("options %+v are accepted", o)
+		}
+	}
+}
+
+func TestReduceLROnPlateau(t *testing.T) {
+	n := NewNetwork()
+	n.SetVerbosity(VerbosityQuiet)
+	s := NewReduceLROnPlateau(NewFlatLearningRate(0.1), ReduceLROnPlateauOptions{Monitor: Monitor{Metric: "val_loss"}, Patience: 2, Factor: 0.5, MinRate: 0.03})
+
+	var rates []float64
+	for epoch, loss := range []float64{1, 0.9, 0.95, 0.96, 0.97, 0.98, 0.99, 1} {
+		rates = append(rates, s.LearningRate(8, epoch+1))
+		s.(EvaluationSchedule).AfterEvaluation(n, epoch+1, epochLog("val_loss", loss))
+	}
+	assertRates(t, rates, []float64{0.1, 0.1, 0.1, 0.1, 0.05, 0.05, 0.03, 0.03})
+
+	if _, err := newReduceLROnPlateau(NewFlatLearningRate(0.1), ReduceLROnPlateauOptions{Factor: 1}); err == nil {
+		t.Fatal("factor of 1 is accepted")
+	}
+}
+
+func TestWrappedReduceLROnPlateau(t *testing.T) {
+	n := newLinearNet()
+
+	// validation loss never improves by a million
+	plateau := NewReduceLROnPlateau(NewFlatLearningRate(0.1), ReduceLROnPlateauOptions{Monitor: Monitor{Metric: "val_loss", MinDelta: 1e6}, Patience: 1, Factor: 0.5})
+	lr := NewWarmup(plateau, WarmupOptions{Epochs: 2})
+	x, y := regData(20)
+	h := n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 4, BatchSize: 5, LearningRate: lr})
+
+	// the first epoch sets the best value
+	assertRates(t, []float64{h.Epochs[0].LearningRate, h.Epochs[1].LearningRate, h.Epochs[2].LearningRate, h.Epochs[3].LearningRate}, []float64{0.05, 0.1, 0.05, 0.025})
+}
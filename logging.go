@@ -0,0 +1,108 @@
+package deeper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	// VerbosityEpoch logs results of every epoch, which is the default
+	VerbosityEpoch = iota
+	// VerbosityQuiet logs nothing during training
+	VerbosityQuiet
+	// VerbosityBatch logs every batch in addition to results of epochs
+	VerbosityBatch
+)
+
+// SetVerbosity sets how much Fit logs: VerbosityEpoch, VerbosityQuiet or
+// VerbosityBatch
+func (n *Network) SetVerbosity(v int) {
+	n.verbosity = v
+}
+
+// SetLogger routes training logs to a structured logger. Results of epochs are
+// logged at the info level with every metric as an attribute, and batches are
+// logged at the debug level. Without a logger, training logs are printed to
+// stdout as text
+func (n *Network) SetLogger(l *slog.Logger) {
+	n.logger = l
+}
+
+// logEpoch logs results of an epoch with training results going first
+func (n *Network) logEpoch(e EpochLog, training, evaluation Evaluation) {
+	if n.verbosity == VerbosityQuiet {
+		return
+	}
+
+	if n.logger == nil {
+		fmt.Printf("Epoch %d (%.2f sec), %s, %s, lr: %.4f\n", e.Epoch, e.Duration.Seconds(), training.summary(), evaluation.summary(), e.LearningRate)
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Int("epoch", e.Epoch),
+		slog.Duration("duration", e.Duration),
+		slog.Float64("lr", e.LearningRate),
+	}
+
+	for _, ev := range []Evaluation{training, evaluation} {
+		for _, name := range ev.order {
+			attrs = append(attrs, slog.Float64(name, ev.Metrics[name]))
+		}
+	}
+
+	n.logger.LogAttrs(context.Background(), slog.LevelInfo, "epoch", attrs...)
+}
+
+// logBatch logs a processed batch
+func (n *Network) logBatch(b BatchInfo) {
+	if n.verbosity != VerbosityBatch {
+		return
+	}
+
+	if n.logger == nil {
+		fmt.Printf("Epoch %d, batch %d/%d, loss: %.4f, gradient norm: %.4f, lr: %.4f\n", b.Epoch, b.Batch, b.Batches, b.Loss, b.GradientNorm, b.LearningRate)
+		return
+	}
+
+	n.logger.LogAttrs(context.Background(), slog.LevelDebug, "batch",
+		slog.Int("epoch", b.Epoch),
+		slog.Int("batch", b.Batch),
+		slog.Int("step", b.Step),
+		slog.Float64("loss", b.Loss),
+		slog.Float64("gradient_norm", b.GradientNorm),
+		slog.Float64("lr", b.LearningRate),
+	)
+}
+
+// warn reports problems that do not stop training
+func (n *Network) warn(msg string, err error) {
+	if n.logger == nil {
+		fmt.Printf("%s: %s\n", msg, err)
+		return
+	}
+
+	n.logger.Warn(msg, slog.Any("error", err))
+}
+
+// notice logs events of training, such as changes of hyperparameters, at the
+// info level
+func (n *Network) notice(msg string, attrs ...slog.Attr) {
+	if n.verbosity == VerbosityQuiet {
+		return
+	}
+
+	if n.logger == nil {
+		text := msg
+
+		for _, a := range attrs {
+			text += fmt.Sprintf(", %s: %v", a.Key, a.Value)
+		}
+
+		fmt.Println(text)
+		return
+	}
+
+	n.logger.LogAttrs(context.Background(), slog.LevelInfo, msg, attrs...)
+}
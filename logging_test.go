@@ -0,0 +1,44 @@
+package deeper
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerVerbosity(t *testing.T) {
+	n := newLinearNet()
+	x, y := regData(20)
+
+	for _, c := range []struct {
+		verbosity int
+		messages  string
+	}{
+		{VerbosityQuiet, ""},
+		{VerbosityEpoch, "epoch epoch"},
+		{VerbosityBatch, "batch batch epoch batch batch epoch"},
+	} {
+		var buf bytes.Buffer
+		n.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		n.SetVerbosity(c.verbosity)
+		n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+
+		var messages []string
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var record map[string]any
+			if err := dec.Decode(&record); err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, record["msg"].(string))
+			if record["msg"] == "epoch" && record["val_loss"] == nil {
+				t.Fatalf("epoch record has no validation loss: %v", record)
+			}
+		}
+		if got := strings.Join(messages, " "); got != c.messages {
+			t.Errorf("verbosity %d logs %q, want %q", c.verbosity, got, c.messages)
+		}
+	}
+}
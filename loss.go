@@ -1,8 +1,11 @@
 package deeper
 
 import (
-	"gonum.org/v1/gonum/mat"
+	"fmt"
+	"log"
 	"math"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 const (
@@ -17,6 +20,13 @@ type Loss interface {
 	Result(count int) float64
 }
 
+// RegressionLoss is an optional interface of loss functions, which tells
+// whether they are meant for regression. Outputs with regression losses are
+// evaluated with RMSE, MAE and R² instead of classification statistics.
+type RegressionLoss interface {
+	Regression() bool
+}
+
 type BinaryCrossEntropy struct {
 	Sum       float64
 	Reduction int
@@ -117,3 +127,218 @@ func (cce *CategoricalCrossEntropy) Derivative(prediction, truth *mat.Dense) *ma
 
 	return tmp
 }
+
+type MeanSquaredError struct {
+	Sum       float64
+	Reduction int
+}
+
+// NewMeanSquaredError creates a loss function for regression, which is the
+// mean of squared differences between predictions and truth
+func NewMeanSquaredError(reduction int) Loss {
+	return &MeanSquaredError{
+		Reduction: reduction,
+	}
+}
+
+func (mse *MeanSquaredError) Regression() bool {
+	return true
+}
+
+func (mse *MeanSquaredError) Reset() {
+	mse.Sum = 0
+}
+
+func (mse *MeanSquaredError) Result(count int) float64 {
+	return reduce(mse.Sum, count, mse.Reduction)
+}
+
+// Loss computes mean((ŷ - y)²) over all outputs of a sample
+func (mse *MeanSquaredError) Loss(prediction, truth *mat.Dense) float64 {
+	y := truth.RawMatrix().Data
+	yHat := prediction.RawMatrix().Data
+
+	sum := float64(0)
+
+	for i := range y {
+		sum += (yHat[i] - y[i]) * (yHat[i] - y[i])
+	}
+
+	return sum / float64(len(y))
+}
+
+// Derivative computes 2(ŷ - y) / n, where n is the number of outputs
+func (mse *MeanSquaredError) Derivative(prediction, truth *mat.Dense) *mat.Dense {
+	mse.Sum += mse.Loss(prediction, truth)
+
+	tmp := mat.NewDense(truth.RawMatrix().Rows, truth.RawMatrix().Cols, nil)
+	tmp.Sub(prediction, truth)
+	tmp.Scale(2/float64(len(truth.RawMatrix().Data)), tmp)
+
+	return tmp
+}
+
+type MeanAbsoluteError struct {
+	Sum       float64
+	Reduction int
+}
+
+// NewMeanAbsoluteError creates a loss function for regression, which is the
+// mean of absolute differences between predictions and truth. It is less
+// sensitive to outliers than MeanSquaredError
+func NewMeanAbsoluteError(reduction int) Loss {
+	return &MeanAbsoluteError{
+		Reduction: reduction,
+	}
+}
+
+func (mae *MeanAbsoluteError) Regression() bool {
+	return true
+}
+
+func (mae *MeanAbsoluteError) Reset() {
+	mae.Sum = 0
+}
+
+func (mae *MeanAbsoluteError) Result(count int) float64 {
+	return reduce(mae.Sum, count, mae.Reduction)
+}
+
+// Loss computes mean(|ŷ - y|) over all outputs of a sample
+func (mae *MeanAbsoluteError) Loss(prediction, truth *mat.Dense) float64 {
+	y := truth.RawMatrix().Data
+	yHat := prediction.RawMatrix().Data
+
+	sum := float64(0)
+
+	for i := range y {
+		sum += math.Abs(yHat[i] - y[i])
+	}
+
+	return sum / float64(len(y))
+}
+
+// Derivative computes sign(ŷ - y) / n, where n is the number of outputs. The
+// derivative at zero is taken as zero
+func (mae *MeanAbsoluteError) Derivative(prediction, truth *mat.Dense) *mat.Dense {
+	mae.Sum += mae.Loss(prediction, truth)
+
+	n := float64(len(truth.RawMatrix().Data))
+
+	tmp := mat.NewDense(truth.RawMatrix().Rows, truth.RawMatrix().Cols, nil)
+	tmp.Sub(prediction, truth)
+	tmp.Apply(func(_, _ int, v float64) float64 {
+		switch {
+		case v > 0:
+			return 1 / n
+		case v < 0:
+			return -1 / n
+		}
+
+		return 0
+	}, tmp)
+
+	return tmp
+}
+
+type Huber struct {
+	Sum       float64
+	Delta     float64
+	Reduction int
+}
+
+// NewHuber creates the Huber loss function (https://doi.org/10.1214/aoms/1177703732),
+// which is quadratic for differences smaller than delta and linear otherwise.
+// It combines sensitivity of MeanSquaredError to small errors with robustness
+// of MeanAbsoluteError to outliers
+func NewHuber(delta float64, reduction int) Loss {
+	if delta <= 0 {
+		log.Fatalln(fmt.Errorf("delta of the Huber loss must be greater than zero"))
+	}
+
+	return &Huber{
+		Delta:     delta,
+		Reduction: reduction,
+	}
+}
+
+func (h *Huber) Regression() bool {
+	return true
+}
+
+func (h *Huber) Reset() {
+	h.Sum = 0
+}
+
+func (h *Huber) Result(count int) float64 {
+	return reduce(h.Sum, count, h.Reduction)
+}
+
+// Loss computes mean of ½(ŷ - y)² for |ŷ - y| <= δ and δ(|ŷ - y| - ½δ)
+// otherwise over all outputs of a sample
+func (h *Huber) Loss(prediction, truth *mat.Dense) float64 {
+	y := truth.RawMatrix().Data
+	yHat := prediction.RawMatrix().Data
+
+	sum := float64(0)
+
+	for i := range y {
+		if e := math.Abs(yHat[i] - y[i]); e <= h.Delta {
+			sum += 0.5 * e * e
+		} else {
+			sum += h.Delta * (e - 0.5*h.Delta)
+		}
+	}
+
+	return sum / float64(len(y))
+}
+
+// Derivative computes (ŷ - y) / n, clipped to [-δ/n, δ/n], where n is the
+// number of outputs
+func (h *Huber) Derivative(prediction, truth *mat.Dense) *mat.Dense {
+	h.Sum += h.Loss(prediction, truth)
+
+	n := float64(len(truth.RawMatrix().Data))
+
+	tmp := mat.NewDense(truth.RawMatrix().Rows, truth.RawMatrix().Cols, nil)
+	tmp.Sub(prediction, truth)
+	tmp.Apply(func(_, _ int, v float64) float64 {
+		return math.Max(-h.Delta, math.Min(h.Delta, v)) / n
+	}, tmp)
+
+	return tmp
+}
+
+// reduce turns the sum of losses of count samples into the result according
+// to the reduction
+func reduce(sum float64, count int, reduction int) float64 {
+	switch reduction {
+	case ReductionMean:
+		return sum / float64(count)
+	case ReductionSum:
+		return sum
+	}
+
+	return math.NaN()
+}
+
+// newLossLike returns a loss function of the same kind and settings as l, but
+// without the sum of its losses
+func newLossLike(l Loss) (Loss, error) {
+	switch t := l.(type) {
+	case nil:
+		return nil, nil
+	case *BinaryCrossEntropy:
+		return NewBinaryCrossEntropy(t.Reduction), nil
+	case *CategoricalCrossEntropy:
+		return NewCategoricalCrossEntropy(t.Reduction), nil
+	case *MeanSquaredError:
+		return NewMeanSquaredError(t.Reduction), nil
+	case *MeanAbsoluteError:
+		return NewMeanAbsoluteError(t.Reduction), nil
+	case *Huber:
+		return NewHuber(t.Delta, t.Reduction), nil
+	}
+
+	return nil, fmt.Errorf("unsupported loss function %T", l)
+}
@@ -0,0 +1,29 @@
+package deeper
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegressionLossDerivatives(t *testing.T) {
+	for _, l := range []Loss{
+		NewMeanSquaredError(ReductionMean),
+		NewMeanAbsoluteError(ReductionMean),
+		NewHuber(0.3, ReductionMean),
+	} {
+		p, y := rnd(3, 1), rnd(3, 1)
+		d := l.Derivative(p, y)
+		for i, num := range numericalGradient(p, func() float64 { return l.Loss(p, y) }) {
+			if e := math.Abs(num - d.At(i, 0)); e > 1e-6 {
+				t.Fatalf("%T: derivative %d differs by %g", l, i, e)
+			}
+		}
+		if !isRegression(l) {
+			t.Fatalf("%T is not a regression loss", l)
+		}
+	}
+
+	if isRegression(NewCategoricalCrossEntropy(ReductionMean)) || isRegression(halfSquaredError{}) {
+		t.Fatal("classification losses are evaluated as regression")
+	}
+}
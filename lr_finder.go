@@ -0,0 +1,165 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// LearningRateRange holds results of the learning rate range test
+type LearningRateRange struct {
+	// Rates are learning rates of steps
+	Rates []float64
+	// Losses are mean losses of batches of steps, and SmoothedLosses are their
+	// exponential moving averages
+	Losses         []float64
+	SmoothedLosses []float64
+	// Suggestion is the rate where the smoothed loss falls the fastest
+	Suggestion float64
+}
+
+// FindLearningRate runs the learning rate range test (Smith,
+// https://doi.org/10.48550/arXiv.1506.01186). A copy of the network is
+// trained for the given number of steps, while the learning rate grows
+// exponentially from minLR to maxLR, and the loss of every step is recorded.
+// The test stops early once the loss diverges. Batches are sized so that the
+// steps pass over the data once. Weights of the network and the state of its
+// optimizer and loss functions are left intact, so only optimizers and loss
+// functions of this package are supported.
+func (n *Network) FindLearningRate(x, y []*mat.Dense, minLR, maxLR float64, steps int) LearningRateRange {
+	if minLR <= 0 || maxLR <= minLR {
+		log.Fatalln(fmt.Errorf("learning rates must satisfy 0 < min < max"))
+	}
+
+	if steps < 2 {
+		log.Fatalln(fmt.Errorf("steps must be greater than one"))
+	}
+
+	train, err := n.samples(x, y, nil, nil)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid training set: %w", err))
+	}
+
+	if len(train) == 0 {
+		log.Fatalln(fmt.Errorf("training set must be greater than zero"))
+	}
+
+	c, err := n.copy()
+	if err != nil {
+		log.Fatalln(fmt.Errorf("could not copy network: %w", err))
+	}
+
+	heads, err := c.heads()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	train = slices.Clone(train)
+	rand.Shuffle(len(train), func(i, j int) {
+		train[i], train[j] = train[j], train[i]
+	})
+
+	batchSize := max(1, len(train)/steps)
+	metrics := make([][]Metric, len(heads))
+	result := LearningRateRange{}
+	avg, best := 0.0, math.Inf(1)
+
+	for step := range steps {
+		i := step * batchSize % len(train)
+		batch := train[i:min(i+batchSize, len(train))]
+		lr := minLR * math.Pow(maxLR/minLR, float64(step)/float64(steps-1))
+
+		loss, _ := c.batch(batch, heads, metrics, lr, 0, 0)
+
+		// Exponential moving average with bias correction
+		avg = 0.9*avg + 0.1*loss
+		smoothed := avg / (1 - math.Pow(0.9, float64(step+1)))
+
+		result.Rates = append(result.Rates, lr)
+		result.Losses = append(result.Losses, loss)
+		result.SmoothedLosses = append(result.SmoothedLosses, smoothed)
+
+		if math.IsNaN(smoothed) || smoothed > 4*best {
+			break
+		}
+
+		best = min(best, smoothed)
+	}
+
+	// Slopes are measured over a tenth of steps, and the first tenth is
+	// skipped, as the moving average is still noisy there
+	result.Suggestion = result.Rates[0]
+	window := max(1, len(result.Rates)/10)
+	steepest := 0.0
+
+	for i := window; i+window < len(result.Rates); i++ {
+		slope := (result.SmoothedLosses[i+window] - result.SmoothedLosses[i]) / math.Log(result.Rates[i+window]/result.Rates[i])
+
+		if slope < steepest {
+			steepest, result.Suggestion = slope, result.Rates[i]
+		}
+	}
+
+	return result
+}
+
+// copy returns a network with copies of layers, fresh loss functions and
+// optimizer of the same kind, and the same parameter groups, which may be
+// trained without touching the original network
+func (n *Network) copy() (*Network, error) {
+	e := &Export{}
+
+	j, err := e.export(n)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewNetwork()
+
+	if err = e.load(c, j); err != nil {
+		return nil, err
+	}
+
+	c.optimizer, err = newOptimizerLike(n.optimizer)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.loss, err = newLossLike(n.loss); err != nil {
+		return nil, err
+	}
+
+	for name, h := range n.outputLosses {
+		if h.loss, err = newLossLike(h.loss); err != nil {
+			return nil, err
+		}
+
+		c.SetOutputLoss(name, h.loss, h.weight)
+	}
+
+	// Groups refer to layers of the network, which are replaced with their
+	// copies, as layers are loaded in the same order. Groups of layers that
+	// are not in the network are dropped, as no layers means every layer
+	for _, g := range n.groups {
+		layers := make([]BackpropagationLayer, 0, len(g.Layers))
+
+		for _, l := range g.Layers {
+			if i := slices.Index(n.Layers, l); i >= 0 {
+				layers = append(layers, c.Layers[i])
+			}
+		}
+
+		if len(g.Layers) > 0 && len(layers) == 0 {
+			continue
+		}
+
+		g.Layers = layers
+		c.groups = append(c.groups, g)
+	}
+
+	return c, nil
+}
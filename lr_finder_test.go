@@ -0,0 +1,70 @@
+package deeper
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestFindLearningRate(t *testing.T) {
+	n := newLinearNet(NewHiddenLayer(8, NewTanh()))
+	n.SetOptimizer(NewSGD(0.9, false))
+	x, y := regData(500)
+
+	weights := mat.DenseCopyOf(n.trainable()[0].Weights())
+	r := n.FindLearningRate(x, y, 1e-5, 10, 50)
+
+	if !mat.Equal(weights, n.trainable()[0].Weights()) || len(n.optimizer.(*SGD).momentums) != 0 {
+		t.Fatal("the network is changed by the range test")
+	}
+	if len(r.Rates) < 2 || r.Rates[0] != 1e-5 || len(r.Losses) != len(r.Rates) || len(r.SmoothedLosses) != len(r.Rates) {
+		t.Fatalf("range test has %d rates from %v", len(r.Rates), r.Rates[0])
+	}
+	// rates grow by the same factor on every step
+	if ratio := r.Rates[1] / r.Rates[0]; math.Abs(ratio-math.Pow(1e6, 1.0/49)) > 1e-9 {
+		t.Fatalf("rates grow by %v", ratio)
+	}
+	if r.Suggestion < r.Rates[0] || r.Suggestion > r.Rates[len(r.Rates)-1] {
+		t.Fatalf("suggestion %v is out of the tested range", r.Suggestion)
+	}
+}
+
+func TestCopyHasFreshLosses(t *testing.T) {
+	g := NewGraph()
+	in := g.Input(2)
+	g.NamedOutput("a", g.Layer(NewOutputLayer(2, NewLinear()), in))
+	g.NamedOutput("b", g.Layer(NewOutputLayer(2, NewSigmoid()), in))
+	n := NewNetwork()
+	n.SetGraph(g)
+	n.SetOptimizer(NewSGD(0, false))
+	n.SetOutputLoss("a", NewHuber(0.5, ReductionSum), 1)
+	n.SetOutputLoss("b", NewBinaryCrossEntropy(ReductionMean), 0.5)
+
+	c, err := n.copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, h := range n.outputLosses {
+		ch := c.outputLosses[name]
+		if ch.loss == h.loss || ch.weight != h.weight {
+			t.Fatalf("output %s shares its loss with the copy", name)
+		}
+	}
+	if huber := c.outputLosses["a"].loss.(*Huber); huber.Delta != 0.5 || huber.Reduction != ReductionSum {
+		t.Fatalf("Huber loss is copied as %+v", huber)
+	}
+
+	// losses of the network are not accumulated by the range test
+	m := newLinearNet()
+	x, y := regData(20)
+	m.FindLearningRate(x, y, 1e-3, 1, 4)
+	if sum := m.loss.(*MeanSquaredError).Sum; sum != 0 {
+		t.Fatalf("loss of the network has sum %v", sum)
+	}
+
+	m.SetLossFunction(halfSquaredError{})
+	if _, err := m.copy(); err == nil {
+		t.Fatal("network with a custom loss function is copied")
+	}
+}
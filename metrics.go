@@ -0,0 +1,235 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ClassStats holds classification metrics of a single class. Support is the
+// number of samples of the class
+type ClassStats struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+	Support   int
+}
+
+// Average holds classification metrics averaged over classes
+type Average struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+}
+
+// classStats computes per class metrics, their averages and Cohen's kappa from
+// the confusion matrix. Macro averages treat all classes equally, weighted ones
+// weigh classes by their support, and micro averages are computed from total
+// counts of true positives, false positives and false negatives. Only classes
+// that appear either in truth or in predictions are averaged.
+func (e *Evaluation) classStats() {
+	e.PerClass = make([]ClassStats, e.Classes)
+
+	predicted := make([]int, e.Classes)
+	total := 0
+
+	for i := range e.Classes {
+		for j := range e.Classes {
+			predicted[j] += e.Matrix[i][j]
+			e.PerClass[i].Support += e.Matrix[i][j]
+		}
+
+		total += e.PerClass[i].Support
+	}
+
+	if total == 0 {
+		return
+	}
+
+	present := 0
+	tp, fp, fn := 0, 0, 0
+	chance := float64(0)
+
+	for i := range e.Classes {
+		c := &e.PerClass[i]
+		correct := e.Matrix[i][i]
+
+		c.Precision = ratio(correct, predicted[i])
+		c.Recall = ratio(correct, c.Support)
+		c.F1 = f1(c.Precision, c.Recall)
+
+		tp += correct
+		fp += predicted[i] - correct
+		fn += c.Support - correct
+		chance += float64(c.Support) * float64(predicted[i]) / float64(total*total)
+
+		if c.Support == 0 && predicted[i] == 0 {
+			continue
+		}
+
+		present++
+		e.Macro.add(c, 1)
+		e.Weighted.add(c, float64(c.Support)/float64(total))
+	}
+
+	e.Macro.scale(1 / float64(present))
+
+	e.Micro.Precision = ratio(tp, tp+fp)
+	e.Micro.Recall = ratio(tp, tp+fn)
+	e.Micro.F1 = f1(e.Micro.Precision, e.Micro.Recall)
+
+	if agreement := ratio(tp, total); chance < 1 {
+		e.Kappa = (agreement - chance) / (1 - chance)
+	} else {
+		e.Kappa = 1
+	}
+}
+
+// ClassificationReport renders precision, recall, F1 score and support of
+// every class along with their averages, accuracy and Cohen's kappa, similar
+// to classification_report of scikit-learn
+func (e Evaluation) ClassificationReport() string {
+	labels := []string{"weighted avg", "Cohen's kappa"}
+	width := 0
+
+	for i := range e.Classes {
+		labels = append(labels, e.className(i))
+	}
+
+	for _, l := range labels {
+		width = max(width, len(l))
+	}
+
+	support := 0
+
+	for _, c := range e.PerClass {
+		support += c.Support
+	}
+
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("%*s %10s %10s %10s %10s\n\n", width, "", "precision", "recall", "f1-score", "support"))
+
+	for i, c := range e.PerClass {
+		buf.WriteString(fmt.Sprintf("%*s %10.4f %10.4f %10.4f %10d\n", width, e.className(i), c.Precision, c.Recall, c.F1, c.Support))
+	}
+
+	buf.WriteString("\n")
+	buf.WriteString(fmt.Sprintf("%*s %10s %10s %10.4f %10d\n", width, "accuracy", "", "", e.Accuracy, support))
+
+	for _, avg := range []struct {
+		name string
+		a    Average
+	}{{"macro avg", e.Macro}, {"micro avg", e.Micro}, {"weighted avg", e.Weighted}} {
+		buf.WriteString(fmt.Sprintf("%*s %10.4f %10.4f %10.4f %10d\n", width, avg.name, avg.a.Precision, avg.a.Recall, avg.a.F1, support))
+	}
+
+	buf.WriteString(fmt.Sprintf("%*s %10s %10s %10.4f\n", width, "Cohen's kappa", "", "", e.Kappa))
+
+	return buf.String()
+}
+
+func (a *Average) add(c *ClassStats, weight float64) {
+	a.Precision += c.Precision * weight
+	a.Recall += c.Recall * weight
+	a.F1 += c.F1 * weight
+}
+
+func (a *Average) scale(s float64) {
+	a.Precision *= s
+	a.Recall *= s
+	a.F1 *= s
+}
+
+// ratio returns a / b or zero if b is zero
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+
+	return float64(a) / float64(b)
+}
+
+// f1 computes the harmonic mean of precision and recall
+func f1(precision, recall float64) float64 {
+	if precision+recall == 0 {
+		return 0
+	}
+
+	return 2 * precision * recall / (precision + recall)
+}
+
+// Metric is a custom metric registered with Network.AddMetric. Add is called
+// for every sample, and Result reduces all samples added since the last Reset
+type Metric interface {
+	// Name returns the name of the metric in the epoch log
+	Name() string
+	Reset()
+	Add(prediction, truth *mat.Dense)
+	Result() float64
+}
+
+type TopKAccuracy struct {
+	k       int
+	correct int
+	total   int
+}
+
+// NewTopKAccuracy creates a metric counting samples whose true class is among
+// k classes with the highest predicted probabilities
+func NewTopKAccuracy(k int) Metric {
+	if k <= 0 {
+		log.Fatalln(fmt.Errorf("k must be greater than zero"))
+	}
+
+	return &TopKAccuracy{k: k}
+}
+
+func (m *TopKAccuracy) Name() string {
+	return fmt.Sprintf("top%d_acc", m.k)
+}
+
+func (m *TopKAccuracy) Reset() {
+	m.correct, m.total = 0, 0
+}
+
+// Add counts classes predicted with higher probability than the true class
+func (m *TopKAccuracy) Add(prediction, truth *mat.Dense) {
+	p := prediction.RawMatrix().Data
+	t := Argmax(truth)
+	higher := 0
+
+	for i := range p {
+		if p[i] > p[t] {
+			higher++
+		}
+	}
+
+	if higher < m.k {
+		m.correct++
+	}
+
+	m.total++
+}
+
+func (m *TopKAccuracy) Result() float64 {
+	return ratio(m.correct, m.total)
+}
+
+func resetMetrics(metrics [][]Metric) {
+	for _, output := range metrics {
+		for _, m := range output {
+			m.Reset()
+		}
+	}
+}
+
+// addMetrics passes predictions and truth of every output to its metrics
+func addMetrics(metrics [][]Metric, predictions, truth []*mat.Dense) {
+	for h, output := range metrics {
+		for _, m := range output {
+			m.Add(predictions[h], truth[h])
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package deeper
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestClassStats(t *testing.T) {
+	// y_true = [0, 0, 1, 2, 2, 2], y_pred = [0, 1, 1, 1, 2, 1]
+	e := newEvaluation(3, []string{"cat", "dog", "horse"})
+	correct := 0
+	for _, p := range [][2]int{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}, {2, 1}} {
+		if e.count(oneHot(3, p[1]), oneHot(3, p[0])) {
+			correct++
+		}
+	}
+	e.summarize(correct, 6)
+
+	want := []ClassStats{
+		{Precision: 1, Recall: 0.5, F1: 2.0 / 3, Support: 2},
+		{Precision: 0.25, Recall: 1, F1: 0.4, Support: 1},
+		{Precision: 1, Recall: 1.0 / 3, F1: 0.5, Support: 3},
+	}
+	for i, w := range want {
+		g := e.PerClass[i]
+		if math.Abs(g.Precision-w.Precision) > 1e-9 || math.Abs(g.Recall-w.Recall) > 1e-9 || math.Abs(g.F1-w.F1) > 1e-9 || g.Support != w.Support {
+			t.Fatalf("class %d: got %+v, want %+v", i, g, w)
+		}
+	}
+
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"macro F1", e.Macro.F1, (2.0/3 + 0.4 + 0.5) / 3},
+		{"weighted F1", e.Weighted.F1, (2*2.0/3 + 0.4 + 3*0.5) / 6},
+		{"micro F1", e.Micro.F1, 0.5},
+		{"kappa", e.Kappa, 1.0 / 3},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s is %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if report := e.ClassificationReport(); !strings.Contains(report, "horse") {
+		t.Fatalf("report has no class names:\n%s", report)
+	}
+}
+
+func TestTopKAccuracy(t *testing.T) {
+	m := NewTopKAccuracy(2)
+	m.Add(mat.NewDense(3, 1, []float64{0.5, 0.3, 0.2}), oneHot(3, 1))
+	m.Add(mat.NewDense(3, 1, []float64{0.5, 0.3, 0.2}), oneHot(3, 2))
+	if m.Name() != "top2_acc" || m.Result() != 0.5 {
+		t.Fatalf("%s is %v", m.Name(), m.Result())
+	}
+	m.Reset()
+	if m.Result() != 0 {
+		t.Fatal("not reset")
+	}
+}
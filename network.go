@@ -3,12 +3,18 @@ package deeper
 import (
 	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"math"
 	"math/rand/v2"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -19,6 +25,16 @@ type Network struct {
 	loss      Loss
 	saver     Exporter
 	callbacks []Callback
+	graph     *Graph
+	groups    []ParameterGroup
+	// Loss functions of named outputs of graphs
+	outputLosses map[string]head
+	// Names of classes of outputs for evaluation reports
+	classNames map[string][]string
+	// Metrics of outputs, with metrics of the only output under ""
+	metrics   map[string][]Metric
+	logger    *slog.Logger
+	verbosity int
 
 	// TODO Start to use pools and arenas to reduce memory allocations
 	//matrices map[int]map[int]*sync.Pool
@@ -36,16 +52,29 @@ func (n *Network) AddLayer(l BackpropagationLayer) {
 		parent.SetOutput(l)
 		l.SetInput(parent)
 
-		if !l.IsInput() && l.Weights() == nil {
-			wi := NewNormWeightInitializer()
-			l.SetWeights(wi.InitWeights(l.Rows(), parent.Rows()))
-			l.SetBiases(wi.InitWeights(l.Rows(), 1))
-		}
+		initParameters(l)
 	}
 
 	n.AddLayerWoWeightInitialization(l)
 }
 
+// initParameters initializes weights and biases of a layer connected to its
+// input, unless the layer already has them
+func initParameters(l BackpropagationLayer) {
+	if l.IsInput() || l.Weights() != nil {
+		return
+	}
+
+	wi := NewNormWeightInitializer()
+
+	if pi, ok := l.(ParametersInitializer); ok {
+		pi.InitParameters(wi)
+	} else {
+		l.SetWeights(wi.InitWeights(l.Rows(), l.Cols()))
+		l.SetBiases(wi.InitWeights(l.Rows(), 1))
+	}
+}
+
 func (n *Network) AddLayerWoWeightInitialization(l BackpropagationLayer) {
 	if len(n.Layers) > 0 {
 		parent := n.Layers[len(n.Layers)-1]
@@ -56,6 +85,17 @@ func (n *Network) AddLayerWoWeightInitialization(l BackpropagationLayer) {
 	n.Layers = append(n.Layers, l)
 }
 
+// SetGraph turns the network into a directed acyclic graph of layers built
+// with Graph, instead of a chain of layers added one by one with AddLayer
+func (n *Network) SetGraph(g *Graph) {
+	if err := g.validate(); err != nil {
+		log.Fatalln(fmt.Errorf("invalid graph: %w", err))
+	}
+
+	n.graph = g
+	n.Layers = g.Layers()
+}
+
 func (n *Network) SetOptimizer(o Optimizer) {
 	n.optimizer = o
 }
@@ -64,52 +104,194 @@ func (n *Network) SetLossFunction(l Loss) {
 	n.loss = l
 }
 
+// SetOutputLoss sets a loss function for a named output (head) of a graph.
+// Errors of the output are multiplied by weight, and the loss reported during
+// training is the weighted sum of losses of all outputs. Every output of a
+// graph with several outputs needs its own loss function.
+func (n *Network) SetOutputLoss(output string, l Loss, weight float64) {
+	if n.outputLosses == nil {
+		n.outputLosses = make(map[string]head)
+	}
+
+	n.outputLosses[output] = head{name: output, loss: l, weight: weight}
+}
+
+// SetClassNames sets names of classes predicted by an output, which are used
+// by evaluation reports instead of class indexes. Networks built of layers
+// added one by one and graphs with a single unnamed output use "" as the
+// name of their output.
+func (n *Network) SetClassNames(output string, names []string) {
+	if n.classNames == nil {
+		n.classNames = make(map[string][]string)
+	}
+
+	n.classNames[output] = names
+}
+
+// AddMetric registers a metric computed over training and validation samples
+// of the only output of the network. Its results are reported in the epoch log
+// and available to callbacks through Evaluation.Metric by the name of the
+// metric for training and with the "val_" prefix for validation
+func (n *Network) AddMetric(m Metric) {
+	n.AddOutputMetric("", m)
+}
+
+// AddOutputMetric registers a metric of a named output of a graph. Its results
+// are reported with the name of the output in square brackets, i.e.,
+// "val_top5_acc[digit]"
+func (n *Network) AddOutputMetric(output string, m Metric) {
+	if n.metrics == nil {
+		n.metrics = make(map[string][]Metric)
+	}
+
+	n.metrics[output] = append(n.metrics[output], m)
+}
+
+// outputMetrics returns metrics of outputs of the network in the order it
+// returns predictions
+func (n *Network) outputMetrics() ([][]Metric, error) {
+	names := n.outputNames()
+	metrics := make([][]Metric, len(names))
+
+	for i, name := range names {
+		if len(names) == 1 && name != "" {
+			metrics[i] = append(metrics[i], n.metrics[""]...)
+		}
+
+		metrics[i] = append(metrics[i], n.metrics[name]...)
+	}
+
+	if len(names) > 1 && len(n.metrics[""]) > 0 {
+		return nil, fmt.Errorf("metrics of models with several outputs must be added with AddOutputMetric")
+	}
+
+	return metrics, nil
+}
+
+// head is an output of a network along with its loss function
+type head struct {
+	name   string
+	loss   Loss
+	weight float64
+}
+
+// heads returns outputs of the network along with their loss functions in
+// the order the network returns predictions
+func (n *Network) heads() ([]head, error) {
+	if n.graph == nil {
+		return []head{{loss: n.loss, weight: 1}}, nil
+	}
+
+	heads := make([]head, len(n.graph.outputNames))
+
+	for i, name := range n.graph.outputNames {
+		if h, ok := n.outputLosses[name]; ok {
+			heads[i] = h
+		} else if len(heads) == 1 && n.loss != nil {
+			heads[i] = head{name: name, loss: n.loss, weight: 1}
+		} else {
+			return nil, fmt.Errorf("output %q has no loss function", name)
+		}
+	}
+
+	return heads, nil
+}
+
 type FitOptions struct {
 	TrainX, TrainY []*mat.Dense
 	ValX, ValY     []*mat.Dense
-	Epochs         int
-	BatchSize      int
-	LearningRate   LearningRate
+	// Named sets of inputs and targets for graphs with several inputs or
+	// outputs. They are used instead of TrainX, TrainY, ValX and ValY
+	TrainInputs, TrainTargets map[string][]*mat.Dense
+	ValInputs, ValTargets     map[string][]*mat.Dense
+	Epochs                    int
+	BatchSize                 int
+	LearningRate              LearningRate
+	// InitialEpoch is the number of epochs completed before, i.e., when
+	// training is resumed from a Checkpoint. Training goes on from the next
+	// epoch up to Epochs
+	InitialEpoch int
+	// ClipValue, if not zero, limits every component of the mean gradient of
+	// a batch to [-ClipValue, ClipValue]
+	ClipValue float64
+	// ClipNorm, if not zero, scales the mean gradient of a batch down so that
+	// its L2 norm over all parameters does not exceed ClipNorm. Clipping by
+	// value goes first
+	ClipNorm float64
 }
 
-func (n *Network) Fit(o FitOptions) Evaluation {
-	if !gt(o.TrainX, 0) || !gt(o.TrainY, 0) || !gt(o.ValX, 0) || !gt(o.ValY, 0) {
-		log.Fatalln(fmt.Errorf("trainX, trainY, valX, and valY must be greater than zero"))
+// Fit trains the network and returns the history of the training session
+func (n *Network) Fit(o FitOptions) *History {
+	train, err := n.samples(o.TrainX, o.TrainY, o.TrainInputs, o.TrainTargets)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid training set: %w", err))
 	}
 
-	if len(o.TrainX) != len(o.TrainY) {
-		log.Fatalln(fmt.Errorf("trainX and trainX must be of the same size"))
+	val, err := n.samples(o.ValX, o.ValY, o.ValInputs, o.ValTargets)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid validation set: %w", err))
 	}
 
-	if len(o.ValX) != len(o.ValY) {
-		log.Fatalln(fmt.Errorf("valX and valX must be of the same size"))
+	if len(train) == 0 || len(val) == 0 {
+		log.Fatalln(fmt.Errorf("training and validation sets must be greater than zero"))
 	}
 
 	if !gt(o.Epochs, 0) {
 		log.Fatalln(fmt.Errorf("epochs must be greater than zero"))
 	}
 
+	if o.InitialEpoch < 0 || o.InitialEpoch >= o.Epochs {
+		log.Fatalln(fmt.Errorf("initial epoch must be in range [0, epochs)"))
+	}
+
 	if !gt(o.BatchSize, 0) {
 		log.Fatalln(fmt.Errorf("batch size must be greater than zero"))
 	}
 
+	if o.ClipValue < 0 || o.ClipNorm < 0 {
+		log.Fatalln(fmt.Errorf("gradient clipping thresholds must not be negative"))
+	}
+
+	heads, err := n.heads()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	metrics, err := n.outputMetrics()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	names := n.outputNames()
+
 	var evaluation Evaluation
+	var history History
 	var now time.Time
-	var elapsed int64
+	var elapsed time.Duration
 	var batchSize int
 
-	datasetSize := len(o.TrainX)
+	datasetSize := len(train)
+	batches := (datasetSize + o.BatchSize - 1) / o.BatchSize
+	step := o.InitialEpoch * batches
+
+	n.onTrainBegin(o)
 
-	for epoch := 1; epoch <= o.Epochs; epoch++ {
-		rand.Shuffle(len(o.TrainX), func(i, j int) {
-			o.TrainX[i], o.TrainX[j] = o.TrainX[j], o.TrainX[i]
-			o.TrainY[i], o.TrainY[j] = o.TrainY[j], o.TrainY[i]
+	for epoch := o.InitialEpoch + 1; epoch <= o.Epochs; epoch++ {
+		rand.Shuffle(len(train), func(i, j int) {
+			train[i], train[j] = train[j], train[i]
 		})
 
 		lr := o.LearningRate.LearningRate(o.Epochs, epoch)
 
 		loss := float64(0)
-		n.loss.Reset()
+
+		for _, h := range heads {
+			h.loss.Reset()
+		}
+
+		resetMetrics(metrics)
+
+		n.onEpochBegin(epoch, lr)
 
 		elapsed = 0
 		now = time.Now()
@@ -120,14 +302,73 @@ func (n *Network) Fit(o FitOptions) Evaluation {
 				batchSize = datasetSize - i
 			}
 
-			n.batch(o.TrainX[i:i+batchSize], o.TrainY[i:i+batchSize], lr/float64(batchSize))
+			step++
+
+			if s, ok := o.LearningRate.(StepLearningRate); ok {
+				lr = s.StepLearningRate(batches*o.Epochs, step)
+			}
+
+			if s, ok := o.LearningRate.(OptimizerSchedule); ok {
+				s.ScheduleOptimizer(n.optimizer, batches*o.Epochs, step)
+			}
+
+			info := BatchInfo{
+				Epoch:        epoch,
+				Batch:        i/o.BatchSize + 1,
+				Batches:      batches,
+				Step:         step,
+				Steps:        batches * o.Epochs,
+				Size:         batchSize,
+				LearningRate: lr,
+			}
+
+			n.onBatchBegin(info)
+
+			info.Loss, info.GradientNorm = n.batch(train[i:i+batchSize], heads, metrics, lr, o.ClipValue, o.ClipNorm)
+
+			n.logBatch(info)
+			n.onBatchEnd(info)
+		}
+		elapsed = time.Since(now)
+
+		for _, h := range heads {
+			loss += h.weight * h.loss.Result(len(train))
+		}
+
+		// Metrics are reused for validation, so their training results are
+		// collected before evaluation
+		training := Evaluation{}
+		training.set("loss", loss)
+
+		for h, name := range names {
+			suffix := ""
+
+			if len(names) > 1 {
+				suffix = "[" + name + "]"
+			}
+
+			for _, m := range metrics[h] {
+				training.set(m.Name()+suffix, m.Result())
+			}
+		}
+
+		evaluation = n.evaluate(val)
+		evaluation.merge(training)
+
+		epochLog := EpochLog{
+			Epoch:        epoch,
+			LearningRate: lr,
+			Duration:     elapsed,
+			Metrics:      maps.Clone(evaluation.Metrics),
 		}
-		elapsed = time.Since(now).Milliseconds()
 
-		loss = n.loss.Result(len(o.TrainX))
-		evaluation = n.Evaluate(o.ValX, o.ValY)
+		history.Epochs = append(history.Epochs, epochLog)
+		n.logEpoch(epochLog, training, evaluation)
+		n.onEpochEnd(epochLog)
 
-		fmt.Printf("Epoch %d (%.2f sec), loss: %.4f, val_acc: %.4f, lr: %.4f\n", epoch, float64(elapsed)/1000, loss, evaluation.Accuracy, lr)
+		if s, ok := o.LearningRate.(EvaluationSchedule); ok {
+			s.AfterEvaluation(n, epoch, evaluation)
+		}
 
 		for _, c := range n.callbacks {
 			proceed := c.AfterEpoch(n, epoch, evaluation)
@@ -140,28 +381,40 @@ func (n *Network) Fit(o FitOptions) Evaluation {
 
 END:
 
-	return evaluation
-}
+	history.Evaluation = evaluation
+
+	n.onTrainEnd(evaluation)
 
-type backpropagationTask struct {
-	x *mat.Dense
-	y *mat.Dense
+	return &history
 }
 
 type backpropagationResult struct {
-	deltaWs *Stack
-	deltaBs *Stack
+	deltaWs     *Stack
+	deltaBs     *Stack
+	predictions []*mat.Dense
+	truth       []*mat.Dense
 }
 
 // batch computes and applies weight and bias updates over a single batch.
-func (n *Network) batch(trainX []*mat.Dense, trainY []*mat.Dense, lr float64) {
-	batchDeltaWs := make([]*mat.Dense, len(n.Layers)-1)
-	batchDeltaBs := make([]*mat.Dense, len(n.Layers)-1)
-
-	// There are no weights and no biases on the input layer
-	for i, l := range n.Layers[1:] {
-		batchDeltaWs[i] = mat.NewDense(l.Rows(), l.Cols(), nil) // [[30, 784], [10, 30]]
-		batchDeltaBs[i] = mat.NewDense(l.Rows(), 1, nil)        // [[30, 1], [10, 1]]
+// Predictions made along the way are passed to training metrics. It returns the
+// mean loss of the batch and the L2 norm of the mean gradient of all parameters
+func (n *Network) batch(samples []sample, heads []head, metrics [][]Metric, lr, clipValue, clipNorm float64) (float64, float64) {
+	loss := float64(0)
+	layers := n.trainable()
+	batchDeltaWs := make([]*mat.Dense, len(layers))
+	batchDeltaBs := make([]*mat.Dense, len(layers))
+	// Rows of weights updated within the batch for layers with sparse updates
+	batchRows := make([]map[int]bool, len(layers))
+
+	for i, l := range layers {
+		r, c := l.Weights().Dims()
+		batchDeltaWs[i] = mat.NewDense(r, c, nil) // [[30, 784], [10, 30]]
+
+		// Some layers (i.e., Embedding) have no biases
+		if l.Biases() != nil {
+			r, c = l.Biases().Dims()
+			batchDeltaBs[i] = mat.NewDense(r, c, nil) // [[30, 1], [10, 1]]
+		}
 	}
 
 	taskWg := &sync.WaitGroup{}
@@ -170,7 +423,7 @@ func (n *Network) batch(trainX []*mat.Dense, trainY []*mat.Dense, lr float64) {
 	resultsWg := &sync.WaitGroup{}
 	resultsWg.Add(1)
 
-	taskCh := make(chan backpropagationTask, runtime.NumCPU())
+	taskCh := make(chan sample, runtime.NumCPU())
 	resultCh := make(chan backpropagationResult, runtime.NumCPU())
 
 	// Create N workers for gradient computing, where N is the number of logical
@@ -180,8 +433,8 @@ func (n *Network) batch(trainX []*mat.Dense, trainY []*mat.Dense, lr float64) {
 			defer taskWg.Done()
 
 			for task := range taskCh {
-				taskDeltaWs, taskDeltaBs := n.computeDeltas(task.x, task.y)
-				resultCh <- backpropagationResult{taskDeltaWs, taskDeltaBs}
+				taskDeltaWs, taskDeltaBs, predictions := n.computeDeltas(task, heads)
+				resultCh <- backpropagationResult{taskDeltaWs, taskDeltaBs, predictions, task.y}
 			}
 		}()
 	}
@@ -193,15 +446,38 @@ func (n *Network) batch(trainX []*mat.Dense, trainY []*mat.Dense, lr float64) {
 		defer resultsWg.Done()
 
 		for result := range resultCh {
-			for i := range len(n.Layers) - 1 {
-				batchDeltaWs[i].Add(batchDeltaWs[i], result.deltaWs.Pop())
-				batchDeltaBs[i].Add(batchDeltaBs[i], result.deltaBs.Pop())
+			addMetrics(metrics, result.predictions, result.truth)
+
+			for h, hd := range heads {
+				loss += hd.weight * hd.loss.Loss(result.predictions[h], result.truth[h])
+			}
+
+			for i := range len(layers) {
+				deltaW, rows := result.deltaWs.PopSparse()
+
+				if rows != nil {
+					if batchRows[i] == nil {
+						batchRows[i] = make(map[int]bool, len(rows))
+					}
+
+					for j, r := range rows {
+						row := batchDeltaWs[i].RawRowView(r)
+						floats.Add(row, deltaW.RawRowView(j))
+						batchRows[i][r] = true
+					}
+				} else {
+					batchDeltaWs[i].Add(batchDeltaWs[i], deltaW)
+				}
+
+				if deltaB := result.deltaBs.Pop(); deltaB != nil {
+					batchDeltaBs[i].Add(batchDeltaBs[i], deltaB)
+				}
 			}
 		}
 	}()
 
-	for i := range len(trainX) {
-		taskCh <- backpropagationTask{trainX[i], trainY[i]}
+	for _, s := range samples {
+		taskCh <- s
 	}
 
 	close(taskCh)
@@ -210,103 +486,405 @@ func (n *Network) batch(trainX []*mat.Dense, trainY []*mat.Dense, lr float64) {
 	close(resultCh)
 	resultsWg.Wait()
 
-	for i := range len(n.Layers) - 1 {
-		n.optimizer.Apply(n.Layers[i+1].Weights(), batchDeltaWs[i], lr)
-		n.optimizer.Apply(n.Layers[i+1].Biases(), batchDeltaBs[i], lr)
+	// Deltas are summed over samples, while optimizers receive the mean
+	// gradient, so that adaptive ones do not depend on the batch size
+	deltas := slices.DeleteFunc(slices.Concat(batchDeltaWs, batchDeltaBs), func(d *mat.Dense) bool { return d == nil })
+	size := float64(len(samples))
+
+	for _, d := range deltas {
+		d.Scale(1/size, d)
+	}
+
+	norm := globalNorm(deltas)
+
+	if clipValue > 0 {
+		for _, d := range deltas {
+			data := d.RawMatrix().Data
+
+			for j := range data {
+				data[j] = max(-clipValue, min(data[j], clipValue))
+			}
+		}
+	}
+
+	if clipNorm > 0 {
+		if clipped := globalNorm(deltas); clipped > clipNorm {
+			for _, d := range deltas {
+				d.Scale(clipNorm/clipped, d)
+			}
+		}
+	}
+
+	for i, l := range layers {
+		if batchRows[i] != nil {
+			n.applySparse(l.Weights(), batchDeltaWs[i], batchRows[i], lr, n.group(l, false))
+		} else {
+			n.apply(l.Weights(), batchDeltaWs[i], lr, n.group(l, false))
+		}
+
+		if l.Biases() != nil {
+			n.apply(l.Biases(), batchDeltaBs[i], lr, n.group(l, true))
+		}
+	}
+
+	return loss / size, norm
+}
+
+// globalNorm returns the L2 norm of all elements of matrices
+func globalNorm(matrices []*mat.Dense) float64 {
+	norm := float64(0)
+
+	for _, m := range matrices {
+		norm += floats.Dot(m.RawMatrix().Data, m.RawMatrix().Data)
 	}
+
+	return math.Sqrt(norm)
 }
 
-func (n *Network) computeDeltas(trainX *mat.Dense, trainY *mat.Dense) (*Stack, *Stack) {
-	activations := NewStack(len(n.Layers))
-	deltaWs := NewStack(len(n.Layers) - 1)
-	deltaBs := NewStack(len(n.Layers) - 1)
+// applySparse passes only rows updated within a batch to the optimizer, so
+// that rows which were not looked up keep their values and the optimizer's
+// state (i.e., momentum) intact. Optimizers keep their state per matrix they
+// receive, so every row gets its own state. Weight decay is applied to the
+// updated rows only.
+func (n *Network) applySparse(weights, deltaWs *mat.Dense, rows map[int]bool, lr float64, g ParameterGroup) {
+	_, cols := weights.Dims()
+
+	for _, r := range slices.Sorted(maps.Keys(rows)) {
+		n.apply(
+			weights.Slice(r, r+1, 0, cols).(*mat.Dense),
+			deltaWs.Slice(r, r+1, 0, cols).(*mat.Dense),
+			lr,
+			g,
+		)
+	}
+}
+
+// trainable returns layers having weights and biases in the same order as
+// their updates are popped from the deltaWs and deltaBs stacks. There are no
+// weights and no biases on the input layer.
+func (n *Network) trainable() []BackpropagationLayer {
+	layers := make([]BackpropagationLayer, 0, len(n.Layers))
 
-	n.Layers[0].Feedforward(trainX, activations)
-	diff := n.loss.Derivative(activations.Peek(), trainY)
+	for _, l := range n.Layers {
+		if l.Weights() != nil {
+			layers = append(layers, l)
+		}
+	}
+
+	return layers
+}
+
+// parameters returns weights and biases of trainable layers
+func (n *Network) parameters() []*mat.Dense {
+	var parameters []*mat.Dense
+
+	for _, l := range n.trainable() {
+		parameters = append(parameters, l.Weights())
+
+		if l.Biases() != nil {
+			parameters = append(parameters, l.Biases())
+		}
+	}
+
+	return parameters
+}
+
+// computeDeltas computes weight and bias updates for a single sample. It also
+// returns predictions made for the sample
+func (n *Network) computeDeltas(s sample, heads []head) (*Stack, *Stack, []*mat.Dense) {
+	deltaWs := NewStack(len(n.Layers))
+	deltaBs := NewStack(len(n.Layers))
+
+	if n.graph != nil {
+		p := n.graph.feedforward(s.x, true)
+		diffs := make([]*mat.Dense, len(heads))
+		predictions := make([]*mat.Dense, len(heads))
+
+		for i, h := range heads {
+			predictions[i] = p.outputs[n.graph.outputs[i].id]
+			diffs[i] = h.loss.Derivative(predictions[i], s.y[i])
+
+			if h.weight != 1 {
+				diffs[i].Scale(h.weight, diffs[i])
+			}
+		}
+
+		n.graph.backpropagation(p, diffs, deltaWs, deltaBs)
+
+		return deltaWs, deltaBs, predictions
+	}
+
+	activations := NewStack(len(n.Layers))
+	prediction := n.Layers[0].Feedforward(s.x[0], activations)
+	diff := heads[0].loss.Derivative(prediction, s.y[0])
 	n.Layers[len(n.Layers)-1].Backpropagation(diff, activations, deltaWs, deltaBs)
 
-	return deltaWs, deltaBs
+	return deltaWs, deltaBs, []*mat.Dense{prediction}
+}
+
+// predict passes a single sample through the network for inference. It returns
+// predictions of all outputs of the network
+func (n *Network) predict(x []*mat.Dense) []*mat.Dense {
+	if n.graph != nil {
+		p := n.graph.feedforward(x, false)
+		predictions := make([]*mat.Dense, len(n.graph.outputs))
+
+		for i, o := range n.graph.outputs {
+			predictions[i] = p.outputs[o.id]
+		}
+
+		return predictions
+	}
+
+	return []*mat.Dense{n.Layers[0].Feedforward(x[0], nil)}
+}
+
+// outputNames returns names of outputs of the network in the order it returns
+// predictions
+func (n *Network) outputNames() []string {
+	if n.graph != nil {
+		return n.graph.outputNames
+	}
+
+	return []string{""}
+}
+
+// outputRows returns sizes of outputs of the network in the order it returns
+// predictions
+func (n *Network) outputRows() []int {
+	if n.graph != nil {
+		rows := make([]int, len(n.graph.outputs))
+
+		for i, o := range n.graph.outputs {
+			rows[i] = o.rows
+		}
+
+		return rows
+	}
+
+	return []int{n.Layers[len(n.Layers)-1].Rows()}
 }
 
 type Evaluation struct {
-	Accuracy  float32
-	Matrix    map[int]map[int]int
-	Recall    map[int]Counter
-	Precision map[int]Counter
+	Accuracy float32
+	// Loss is the mean loss per sample computed with loss functions of outputs.
+	// For models with several outputs, it is the weighted sum of their losses.
+	// Networks without loss functions (i.e., loaded for inference) have none
+	Loss float64
+	// Classes is the number of classes of the output. Outputs of a single
+	// neuron (i.e., sigmoid for binary classification) have two classes, which
+	// are told apart by the 0.5 threshold
+	Classes int
+	// ClassNames are optional names of classes set with Network.SetClassNames
+	ClassNames []string
+	Matrix     map[int]map[int]int
+	Recall     map[int]Counter
+	Precision  map[int]Counter
+	// PerClass holds precision, recall, F1 score and support of every class
+	PerClass []ClassStats
+	// Macro, Micro and Weighted are averages of PerClass
+	Macro    Average
+	Micro    Average
+	Weighted Average
+	// Kappa is Cohen's kappa, agreement of predictions and truth corrected for
+	// agreement by chance
+	Kappa float64
+	// Regression is set for outputs trained with regression loss functions
+	// (MeanSquaredError, MeanAbsoluteError and Huber), which are evaluated with
+	// RMSE, MAE and R² instead of Accuracy and the confusion matrix
+	Regression bool
+	RMSE       float64
+	MAE        float64
+	R2         float64
+	// Outputs holds evaluation of every output of models with several outputs
+	Outputs map[string]Evaluation
+	// Metrics holds results by the names they have in the epoch log, i.e.,
+	// "val_acc", "val_rmse" or "val_" and the name of a registered metric.
+	// During training it also holds training loss ("loss") and training
+	// results of registered metrics
+	Metrics map[string]float64
+
+	sums *regressionSums
+	// order of Metrics in the epoch log
+	order []string
+	// withLoss is set when Loss is computed
+	withLoss bool
+}
+
+// Metric returns a result by its name in the epoch log
+func (e Evaluation) Metric(name string) (float64, bool) {
+	v, ok := e.Metrics[name]
+	return v, ok
+}
+
+// regressionSums accumulates errors and targets of every output neuron
+type regressionSums struct {
+	count         int
+	squaredError  []float64
+	absoluteError []float64
+	// Running mean and sum of squared deviations of targets (Welford's
+	// algorithm)
+	mean       []float64
+	deviations []float64
 }
 
+// ConfusionMatrix renders the confusion matrix with truth in rows and
+// predictions in columns, along with recall of every class in the last column
+// and precision of every class in the last row. Columns are as narrow as their
+// values allow, and both rows and columns are labelled with class names if
+// there are any, or with class indexes otherwise.
 func (e Evaluation) ConfusionMatrix() string {
 	buf := strings.Builder{}
-	buf.WriteString("          ")
 
-	for i := range 10 {
-		buf.WriteString(fmt.Sprintf("%5d", i) + " ")
+	label := 0
+	width := len("100.00")
+
+	for i := range e.Classes {
+		label = max(label, len(e.className(i)))
+		width = max(width, len(e.className(i)))
+
+		for _, val := range e.Matrix[i] {
+			width = max(width, len(strconv.Itoa(val)))
+		}
+	}
+
+	label = max(label, len("Precision"))
+
+	buf.WriteString(fmt.Sprintf("%*s ", label, ""))
+
+	for i := range e.Classes {
+		buf.WriteString(fmt.Sprintf("%*s ", width, e.className(i)))
 	}
 
 	buf.WriteString(" Recall\n")
 
-	for i := range 10 {
-		for j := range 10 {
-			if j == 0 {
-				buf.WriteString(fmt.Sprintf("%9d", i) + " ")
-			}
+	for i := range e.Classes {
+		buf.WriteString(fmt.Sprintf("%*s ", label, e.className(i)))
 
-			if val, ok := e.Matrix[i][j]; ok {
-				buf.WriteString(fmt.Sprintf("%5d", val) + " ")
-			} else {
-				buf.WriteString(fmt.Sprintf("%5d", 0) + " ")
-			}
+		for j := range e.Classes {
+			buf.WriteString(fmt.Sprintf("%*d ", width, e.Matrix[i][j]))
 		}
 
-		if val, ok := e.Recall[i]; ok {
-			buf.WriteString(fmt.Sprintf("  %.2f", val.percent) + " ")
-		}
+		buf.WriteString(fmt.Sprintf(" %6.2f\n", e.Recall[i].Percent))
+	}
+
+	buf.WriteString(fmt.Sprintf("%*s ", label, "Precision"))
 
-		buf.WriteString("\n")
+	for i := range e.Classes {
+		buf.WriteString(fmt.Sprintf("%*.2f ", width, e.Precision[i].Percent))
 	}
 
-	buf.WriteString("Precision ")
+	return buf.String()
+}
 
-	for i := range 10 {
-		if val, ok := e.Precision[i]; ok {
-			buf.WriteString(fmt.Sprintf("%.2f", val.percent) + " ")
-		} else {
-			buf.WriteString(fmt.Sprintf("%5d", 0) + " ")
+// TopConfusions renders up to limit most frequent mistakes as "truth ->
+// prediction" pairs, which is a more practical view of the confusion matrix
+// than the whole matrix when there are hundreds of classes
+func (e Evaluation) TopConfusions(limit int) string {
+	type confusion struct {
+		truth, prediction, count int
+	}
+
+	confusions := make([]confusion, 0)
+
+	for i, row := range e.Matrix {
+		for j, count := range row {
+			if i != j && count > 0 {
+				confusions = append(confusions, confusion{i, j, count})
+			}
+		}
+	}
+
+	slices.SortFunc(confusions, func(a, b confusion) int {
+		if a.count != b.count {
+			return b.count - a.count
 		}
+
+		if a.truth != b.truth {
+			return a.truth - b.truth
+		}
+
+		return a.prediction - b.prediction
+	})
+
+	buf := strings.Builder{}
+
+	for _, c := range confusions[:min(limit, len(confusions))] {
+		buf.WriteString(fmt.Sprintf("%s -> %s: %d\n", e.className(c.truth), e.className(c.prediction), c.count))
 	}
 
 	return buf.String()
 }
 
-type Counter struct {
-	correct int
-	total   int
-	percent float32
+// className returns the name of a class or its index if classes have no names
+func (e Evaluation) className(i int) string {
+	if i < len(e.ClassNames) {
+		return e.ClassNames[i]
+	}
+
+	return strconv.Itoa(i)
 }
 
-type evaluationTask struct {
-	x *mat.Dense
-	y *mat.Dense
+// Counter holds correct predictions of a class out of all samples of the
+// class (recall) or all predictions of the class (precision) in percent
+type Counter struct {
+	Correct int
+	Total   int
+	Percent float32
 }
 
 type evaluationResult struct {
-	pred  *mat.Dense
-	truth *mat.Dense
+	pred  []*mat.Dense
+	truth []*mat.Dense
 }
 
 func (n *Network) Evaluate(valX []*mat.Dense, valY []*mat.Dense) Evaluation {
-	//var res *mat.Dense
-	var evaluation Evaluation
-	var correct int
+	samples, err := n.samples(valX, valY, nil, nil)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid evaluation set: %w", err))
+	}
 
-	evaluation.Matrix = make(map[int]map[int]int, 10)
-	evaluation.Recall = make(map[int]Counter, 10)
-	evaluation.Precision = make(map[int]Counter, 10)
+	return n.evaluate(samples)
+}
 
-	for i := range 10 {
-		evaluation.Matrix[i] = make(map[int]int, 10)
-		evaluation.Recall[i] = Counter{}
-		evaluation.Precision[i] = Counter{}
+// EvaluateNamed evaluates a graph with several inputs or outputs on named sets
+// of inputs and targets. Every output is evaluated separately and reported in
+// Evaluation.Outputs
+func (n *Network) EvaluateNamed(inputs, targets map[string][]*mat.Dense) Evaluation {
+	samples, err := n.samples(nil, nil, inputs, targets)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid evaluation set: %w", err))
+	}
+
+	return n.evaluate(samples)
+}
+
+func (n *Network) evaluate(samples []sample) Evaluation {
+	names := n.outputNames()
+	evaluations := make([]Evaluation, len(names))
+	correct := make([]int, len(names))
+	losses := make([]float64, len(names))
+
+	rows := n.outputRows()
+
+	// Networks without loss functions (i.e., loaded for inference) are
+	// evaluated as classifiers
+	heads, err := n.heads()
+	withLoss := err == nil && heads[0].loss != nil
+
+	metrics, err := n.outputMetrics()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	resetMetrics(metrics)
+
+	for h, name := range names {
+		if h < len(heads) && isRegression(heads[h].loss) {
+			evaluations[h] = newRegressionEvaluation(rows[h])
+		} else {
+			evaluations[h] = newEvaluation(rows[h], n.classNames[name])
+		}
 	}
 
 	taskWg := &sync.WaitGroup{}
@@ -315,7 +893,7 @@ func (n *Network) Evaluate(valX []*mat.Dense, valY []*mat.Dense) Evaluation {
 	resultsWg := &sync.WaitGroup{}
 	resultsWg.Add(1)
 
-	taskCh := make(chan evaluationTask, runtime.NumCPU())
+	taskCh := make(chan sample, runtime.NumCPU())
 	resultCh := make(chan evaluationResult, runtime.NumCPU())
 
 	for range runtime.NumCPU() {
@@ -323,7 +901,7 @@ func (n *Network) Evaluate(valX []*mat.Dense, valY []*mat.Dense) Evaluation {
 			defer taskWg.Done()
 
 			for task := range taskCh {
-				p := n.Layers[0].Feedforward(task.x, nil)
+				p := n.predict(task.x)
 				resultCh <- evaluationResult{p, task.y}
 			}
 		}()
@@ -333,43 +911,24 @@ func (n *Network) Evaluate(valX []*mat.Dense, valY []*mat.Dense) Evaluation {
 		defer resultsWg.Done()
 
 		for result := range resultCh {
-			truth := Argmax(result.truth)
-			prediction := Argmax(result.pred)
-
-			evaluation.Matrix[truth][prediction] += 1
-
-			if prediction == truth {
-				correct++
-
-				// Recall (per label)
-				if v, ok := evaluation.Recall[truth]; ok {
-					v.correct += 1
-					evaluation.Recall[truth] = v
+			for h := range evaluations {
+				if evaluations[h].count(result.pred[h], result.truth[h]) {
+					correct[h]++
 				}
 
-				// Precision (per label)
-				if v, ok := evaluation.Precision[prediction]; ok {
-					v.correct += 1
-					evaluation.Precision[prediction] = v
+				// Loss doesn't change the state of loss functions, unlike
+				// Derivative used during training
+				if withLoss {
+					losses[h] += heads[h].loss.Loss(result.pred[h], result.truth[h])
 				}
 			}
 
-			// Recall (per label)
-			if v, ok := evaluation.Recall[truth]; ok {
-				v.total += 1
-				evaluation.Recall[truth] = v
-			}
-
-			// Precision (per label)
-			if v, ok := evaluation.Precision[prediction]; ok {
-				v.total += 1
-				evaluation.Precision[prediction] = v
-			}
+			addMetrics(metrics, result.pred, result.truth)
 		}
 	}()
 
-	for i := range len(valX) {
-		taskCh <- evaluationTask{valX[i], valY[i]}
+	for _, s := range samples {
+		taskCh <- s
 	}
 
 	close(taskCh)
@@ -378,24 +937,281 @@ func (n *Network) Evaluate(valX []*mat.Dense, valY []*mat.Dense) Evaluation {
 	close(resultCh)
 	resultsWg.Wait()
 
+	for h := range evaluations {
+		evaluations[h].summarize(correct[h], len(samples))
+
+		if withLoss {
+			evaluations[h].Loss = losses[h] / float64(len(samples))
+			evaluations[h].withLoss = true
+		}
+
+		evaluations[h].report(evaluations[h], "", metrics[h])
+	}
+
+	if len(evaluations) == 1 {
+		return evaluations[0]
+	}
+
+	// Models with several outputs are reported per output, while their overall
+	// accuracy is the mean accuracy of all classification outputs
+	evaluation := Evaluation{Outputs: make(map[string]Evaluation, len(names)), withLoss: withLoss}
+	classifiers := 0
+
+	if withLoss {
+		for h := range evaluations {
+			evaluation.Loss += heads[h].weight * evaluations[h].Loss
+		}
+
+		evaluation.set("val_loss", evaluation.Loss)
+	}
+
+	for h, name := range names {
+		evaluation.Outputs[name] = evaluations[h]
+
+		if !evaluations[h].Regression {
+			evaluation.Accuracy += evaluations[h].Accuracy
+			classifiers++
+		}
+	}
+
+	if classifiers > 0 {
+		evaluation.Accuracy /= float32(classifiers)
+		evaluation.set("val_acc", float64(evaluation.Accuracy))
+	}
+
+	for h, name := range names {
+		evaluation.report(evaluations[h], "["+name+"]", metrics[h])
+	}
+
+	return evaluation
+}
+
+// newEvaluation creates an evaluation of an output of the given size, or of
+// the number of class names when there are more of them
+func newEvaluation(rows int, classNames []string) Evaluation {
+	var evaluation Evaluation
+
+	evaluation.ClassNames = classNames
+	evaluation.Matrix = make(map[int]map[int]int)
+	evaluation.Recall = make(map[int]Counter)
+	evaluation.Precision = make(map[int]Counter)
+	evaluation.grow(max(rows, len(classNames), 2))
+
+	return evaluation
+}
+
+// grow adds classes up to the given number, so that labels beyond outputs of
+// the network still get their rows and columns in the confusion matrix
+func (e *Evaluation) grow(classes int) {
+	for i := e.Classes; i < classes; i++ {
+		e.Matrix[i] = make(map[int]int)
+		e.Recall[i] = Counter{}
+		e.Precision[i] = Counter{}
+	}
+
+	e.Classes = max(e.Classes, classes)
+}
+
+// newRegressionEvaluation creates an evaluation of a regression output of the
+// given size
+func newRegressionEvaluation(rows int) Evaluation {
+	return Evaluation{
+		Regression: true,
+		sums: &regressionSums{
+			squaredError:  make([]float64, rows),
+			absoluteError: make([]float64, rows),
+			mean:          make([]float64, rows),
+			deviations:    make([]float64, rows),
+		},
+	}
+}
+
+// isRegression reports whether the loss function is meant for regression
+func isRegression(l Loss) bool {
+	r, ok := l.(RegressionLoss)
+
+	return ok && r.Regression()
+}
+
+// count adds a single prediction to the confusion matrix and per label
+// statistics. It returns whether the prediction is correct
+func (e *Evaluation) count(pred, truth *mat.Dense) bool {
+	if e.Regression {
+		e.sums.add(pred, truth)
+		return false
+	}
+
+	t := class(truth)
+	prediction := class(pred)
+
+	// The label set may be larger than the output (e.g., targets have more
+	// rows than the output layer)
+	e.grow(max(t, prediction) + 1)
+
+	e.Matrix[t][prediction] += 1
+
+	if prediction == t {
+		// Recall (per label)
+		if v, ok := e.Recall[t]; ok {
+			v.Correct += 1
+			e.Recall[t] = v
+		}
+
+		// Precision (per label)
+		if v, ok := e.Precision[prediction]; ok {
+			v.Correct += 1
+			e.Precision[prediction] = v
+		}
+	}
+
+	// Recall (per label)
+	if v, ok := e.Recall[t]; ok {
+		v.Total += 1
+		e.Recall[t] = v
+	}
+
+	// Precision (per label)
+	if v, ok := e.Precision[prediction]; ok {
+		v.Total += 1
+		e.Precision[prediction] = v
+	}
+
+	return prediction == t
+}
+
+// summarize computes overall accuracy and per label statistics, or regression
+// metrics for regression outputs
+func (e *Evaluation) summarize(correct, total int) {
+	if e.Regression {
+		e.RMSE, e.MAE, e.R2 = e.sums.metrics()
+		return
+	}
+
 	// Overall Accuracy
-	evaluation.Accuracy = float32(correct) / float32(len(valX))
+	e.Accuracy = float32(correct) / float32(total)
 
-	for i := range 10 {
+	for i := range e.Classes {
 		// Recall (per label)
-		if v, ok := evaluation.Recall[i]; ok {
-			v.percent = (float32(v.correct) / float32(v.total)) * 100
-			evaluation.Recall[i] = v
+		if v, ok := e.Recall[i]; ok && v.Total > 0 {
+			v.Percent = (float32(v.Correct) / float32(v.Total)) * 100
+			e.Recall[i] = v
 		}
 
 		// Precision (per label)
-		if v, ok := evaluation.Precision[i]; ok {
-			v.percent = float32(v.correct) / float32(v.total) * 100
-			evaluation.Precision[i] = v
+		if v, ok := e.Precision[i]; ok && v.Total > 0 {
+			v.Percent = float32(v.Correct) / float32(v.Total) * 100
+			e.Precision[i] = v
 		}
 	}
 
-	return evaluation
+	e.classStats()
+}
+
+// class returns the class of a prediction or truth. Outputs of a single neuron
+// are thresholded at 0.5
+func class(m *mat.Dense) int {
+	if r, _ := m.Dims(); r == 1 {
+		if m.At(0, 0) >= 0.5 {
+			return 1
+		}
+
+		return 0
+	}
+
+	return Argmax(m)
+}
+
+// set sets a result by its name in the epoch log
+func (e *Evaluation) set(name string, v float64) {
+	if e.Metrics == nil {
+		e.Metrics = make(map[string]float64)
+	}
+
+	if _, ok := e.Metrics[name]; !ok {
+		e.order = append(e.order, name)
+	}
+
+	e.Metrics[name] = v
+}
+
+// report sets validation results of an output, which are named with the suffix
+func (e *Evaluation) report(o Evaluation, suffix string, metrics []Metric) {
+	if o.withLoss {
+		e.set("val_loss"+suffix, o.Loss)
+	}
+
+	if o.Regression {
+		e.set("val_rmse"+suffix, o.RMSE)
+		e.set("val_mae"+suffix, o.MAE)
+		e.set("val_r2"+suffix, o.R2)
+	} else {
+		e.set("val_acc"+suffix, float64(o.Accuracy))
+	}
+
+	for _, m := range metrics {
+		e.set("val_"+m.Name()+suffix, m.Result())
+	}
+}
+
+// merge adds results of another evaluation (i.e., training results) to Metrics
+// without reporting them in the epoch log
+func (e *Evaluation) merge(o Evaluation) {
+	for name, v := range o.Metrics {
+		if e.Metrics == nil {
+			e.Metrics = make(map[string]float64)
+		}
+
+		e.Metrics[name] = v
+	}
+}
+
+// summary returns results for the epoch log
+func (e Evaluation) summary() string {
+	parts := make([]string, len(e.order))
+
+	for i, name := range e.order {
+		parts[i] = fmt.Sprintf("%s: %.4f", name, e.Metrics[name])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (s *regressionSums) add(pred, truth *mat.Dense) {
+	y := truth.RawMatrix().Data
+	yHat := pred.RawMatrix().Data
+
+	s.count++
+
+	for i := range y {
+		diff := yHat[i] - y[i]
+		s.squaredError[i] += diff * diff
+		s.absoluteError[i] += math.Abs(diff)
+
+		delta := y[i] - s.mean[i]
+		s.mean[i] += delta / float64(s.count)
+		s.deviations[i] += delta * (y[i] - s.mean[i])
+	}
+}
+
+// metrics computes RMSE, MAE and R² over all output neurons. R² is computed as
+// 1 - SSres / SStot, where both sums are taken over all neurons, so that
+// neurons with larger variance of targets weigh more. Constant targets have
+// R² of 1 when they are predicted exactly and 0 otherwise
+func (s *regressionSums) metrics() (float64, float64, float64) {
+	values := float64(s.count * len(s.mean))
+
+	residual := floats.Sum(s.squaredError)
+	total := floats.Sum(s.deviations)
+	r2 := float64(0)
+
+	switch {
+	case total > 0:
+		r2 = 1 - residual/total
+	case residual == 0:
+		r2 = 1
+	}
+
+	return math.Sqrt(residual / values), floats.Sum(s.absoluteError) / values, r2
 }
 
 func (n *Network) AddCallback(c Callback) {
@@ -0,0 +1,181 @@
+package deeper
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// oneHot returns a column of the given size with the class set
+func oneHot(size, class int) *mat.Dense {
+	m := mat.NewDense(size, 1, nil)
+	m.Set(class, 0, 1)
+	return m
+}
+
+func TestEvaluationClasses(t *testing.T) {
+	for _, c := range []struct {
+		rows    int
+		names   []string
+		classes int
+	}{
+		{rows: 1, classes: 2},
+		{rows: 3, classes: 3},
+		{rows: 2, names: []string{"a", "b", "c", "d"}, classes: 4},
+		{rows: 150, classes: 150},
+	} {
+		if e := newEvaluation(c.rows, c.names); e.Classes != c.classes {
+			t.Errorf("evaluation of %d rows and %d names has %d classes, want %d", c.rows, len(c.names), e.Classes, c.classes)
+		}
+	}
+
+	// labels beyond the output grow the matrix
+	e := newEvaluation(2, nil)
+	e.count(oneHot(5, 1), oneHot(5, 4))
+	e.summarize(0, 1)
+	if e.Classes != 5 || e.Matrix[4][1] != 1 || len(e.PerClass) != 5 {
+		t.Fatalf("got %d classes and matrix %v", e.Classes, e.Matrix)
+	}
+}
+
+func TestConfusionMatrixClassNames(t *testing.T) {
+	e := newEvaluation(3, []string{"cat", "dog", "horse"})
+	correct := 0
+	for _, p := range [][2]int{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}, {2, 1}} {
+		if e.count(oneHot(3, p[1]), oneHot(3, p[0])) {
+			correct++
+		}
+	}
+	e.summarize(correct, 6)
+
+	lines := strings.Split(e.ConfusionMatrix(), "\n")
+	if got := strings.Fields(lines[0]); strings.Join(got, " ") != "cat dog horse Recall" {
+		t.Fatalf("header is %q", lines[0])
+	}
+	for i, name := range []string{"cat", "dog", "horse", "Precision"} {
+		if !strings.HasPrefix(strings.TrimSpace(lines[i+1]), name) {
+			t.Fatalf("row %d is %q", i+1, lines[i+1])
+		}
+	}
+	if got := e.TopConfusions(1); got != "horse -> dog: 2\n" {
+		t.Fatalf("top confusion is %q", got)
+	}
+}
+
+// regData returns samples of two targets, a non-linear and a linear function
+// of two inputs
+func regData(k int) ([]*mat.Dense, []*mat.Dense) {
+	var xs, ys []*mat.Dense
+	for range k {
+		x := rnd(2, 1)
+		xs = append(xs, x)
+		ys = append(ys, mat.NewDense(2, 1, []float64{math.Sin(2 * x.At(0, 0)), 3*x.At(1, 0) + 1}))
+	}
+	return xs, ys
+}
+
+// newLinearNet returns a network of two inputs and two linear outputs with
+// hidden layers in between, trained by SGD to minimize MSE without logging
+func newLinearNet(hidden ...BackpropagationLayer) *Network {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(2))
+	for _, l := range hidden {
+		n.AddLayer(l)
+	}
+	n.AddLayer(NewOutputLayer(2, NewLinear()))
+	n.SetOptimizer(NewSGD(0, false))
+	n.SetLossFunction(NewMeanSquaredError(ReductionMean))
+	n.SetVerbosity(VerbosityQuiet)
+	return n
+}
+
+func TestRegressionMetrics(t *testing.T) {
+	e := newRegressionEvaluation(1)
+	for i, p := range []float64{1, 2, 4} {
+		e.count(mat.NewDense(1, 1, []float64{p}), mat.NewDense(1, 1, []float64{float64(i + 1)}))
+	}
+	e.summarize(0, 3)
+	if math.Abs(e.R2-0.5) > 1e-12 || math.Abs(e.MAE-1.0/3) > 1e-12 || math.Abs(e.RMSE-math.Sqrt(1.0/3)) > 1e-12 {
+		t.Fatalf("got R² %v, MAE %v and RMSE %v", e.R2, e.MAE, e.RMSE)
+	}
+
+	// constant targets
+	for _, c := range []struct{ prediction, r2 float64 }{{1e6, 1}, {1e6 + 1, 0}} {
+		e := newRegressionEvaluation(1)
+		for range 3 {
+			e.count(mat.NewDense(1, 1, []float64{c.prediction}), mat.NewDense(1, 1, []float64{1e6}))
+		}
+		e.summarize(0, 3)
+		if e.R2 != c.r2 {
+			t.Fatalf("R² of constant targets predicted as %v is %v", c.prediction, e.R2)
+		}
+	}
+}
+
+func TestRegressionFit(t *testing.T) {
+	for _, l := range []Loss{NewMeanSquaredError(ReductionMean), NewHuber(1, ReductionMean)} {
+		n := newLinearNet(NewHiddenLayer(16, NewTanh()))
+		n.SetOptimizer(NewSGD(0.9, false))
+		n.SetLossFunction(l)
+		tx, ty := regData(2000)
+		vx, vy := regData(300)
+		ev := n.Fit(FitOptions{TrainX: tx, TrainY: ty, ValX: vx, ValY: vy, Epochs: 8, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)}).Evaluation
+		if !ev.Regression || ev.R2 < 0.9 {
+			t.Fatalf("%T: R² is %v", l, ev.R2)
+		}
+	}
+}
+
+func TestValidationLoss(t *testing.T) {
+	n := newLinearNet()
+	x, y := regData(10)
+
+	want := 0.0
+	for i := range x {
+		want += n.loss.Loss(forwardOf(n, x[i]), y[i]) / float64(len(x))
+	}
+
+	ev := n.Evaluate(x, y)
+	if v, ok := ev.Metric("val_loss"); !ok || math.Abs(v-want) > 1e-12 || math.Abs(ev.Loss-want) > 1e-12 {
+		t.Fatalf("validation loss is %v, want %v", ev.Loss, want)
+	}
+}
+
+func TestGradientClipping(t *testing.T) {
+	for _, c := range []struct{ value, norm float64 }{{0, 0}, {0.001, 0}, {0, 0.01}, {0.001, 0.001}} {
+		n := newLinearNet(NewHiddenLayer(8, NewTanh()))
+		r := &recorder{}
+		n.AddCallback(r)
+
+		var before []*mat.Dense
+		for _, p := range n.parameters() {
+			before = append(before, mat.DenseCopyOf(p))
+		}
+
+		// a single step with the rate of 1 changes parameters by the gradient
+		x, y := regData(16)
+		n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 1, BatchSize: 16, LearningRate: NewFlatLearningRate(1), ClipValue: c.value, ClipNorm: c.norm})
+
+		norm, largest := 0.0, 0.0
+		for i, p := range n.parameters() {
+			for j, v := range p.RawMatrix().Data {
+				d := before[i].RawMatrix().Data[j] - v
+				norm += d * d
+				largest = max(largest, math.Abs(d))
+			}
+		}
+		norm = math.Sqrt(norm)
+
+		unclipped := r.batches[0].GradientNorm
+		switch {
+		case c.value > 0 && largest > c.value+1e-12:
+			t.Errorf("%+v: component %v is not clipped", c, largest)
+		case c.norm > 0 && math.Abs(norm-min(c.norm, unclipped)) > 1e-9:
+			t.Errorf("%+v: norm %v is not clipped", c, norm)
+		case c.value == 0 && c.norm == 0 && math.Abs(norm-unclipped) > 1e-9:
+			t.Errorf("norm of the update is %v, gradient norm is %v", norm, unclipped)
+		}
+	}
+}
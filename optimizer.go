@@ -1,8 +1,10 @@
 package deeper
 
 import (
+	"fmt"
 	"gonum.org/v1/gonum/mat"
-	"slices"
+	"log"
+	"math"
 	"unsafe"
 )
 
@@ -10,6 +12,20 @@ type Optimizer interface {
 	Apply(weights, deltaWs *mat.Dense, lr float64)
 }
 
+// statefulOptimizer is implemented by optimizers keeping state per parameter
+// (i.e., a matrix of weights or biases, or a row of it for sparse updates),
+// which is saved in checkpoints
+type statefulOptimizer interface {
+	state(p *mat.Dense) []*mat.Dense
+	setState(p *mat.Dense, state []*mat.Dense) error
+}
+
+// MomentumOptimizer is implemented by optimizers whose momentum may be changed
+// during training (see OptimizerSchedule)
+type MomentumOptimizer interface {
+	SetMomentum(momentum float64)
+}
+
 type SGD struct {
 	momentum  float64
 	momentums map[uintptr]*mat.Dense
@@ -24,12 +40,16 @@ func NewSGD(momentum float64, nesterov bool) Optimizer {
 	}
 }
 
+func (s *SGD) SetMomentum(momentum float64) {
+	s.momentum = momentum
+}
+
 func (s *SGD) Apply(weights, deltaWs *mat.Dense, lr float64) {
 	rows := deltaWs.RawMatrix().Rows
 	cols := deltaWs.RawMatrix().Cols
 
 	if s.momentum > 0 && s.momentum < 1 {
-		p := uintptr(unsafe.Pointer(&weights.RawMatrix().Data[0]))
+		p := parameterKey(weights)
 
 		if m, ok := s.momentums[p]; ok {
 			// Multiply stored velocity by momentum (i.e., v*0.9)
@@ -53,7 +73,8 @@ func (s *SGD) Apply(weights, deltaWs *mat.Dense, lr float64) {
 				deltaWs.Copy(m)
 			}
 		} else {
-			s.momentums[p] = mat.NewDense(rows, cols, slices.Clone(weights.RawMatrix().Data))
+			// Velocity starts from the first gradient
+			s.momentums[p] = mat.DenseCopyOf(deltaWs)
 		}
 	}
 
@@ -61,3 +82,267 @@ func (s *SGD) Apply(weights, deltaWs *mat.Dense, lr float64) {
 	tmp.Scale(lr, deltaWs)
 	weights.Sub(weights, tmp)
 }
+
+func (s *SGD) state(p *mat.Dense) []*mat.Dense {
+	if m, ok := s.momentums[parameterKey(p)]; ok {
+		return []*mat.Dense{m}
+	}
+
+	return nil
+}
+
+func (s *SGD) setState(p *mat.Dense, state []*mat.Dense) error {
+	if err := checkState(p, state, 1); err != nil {
+		return err
+	}
+
+	s.momentums[parameterKey(p)] = state[0]
+
+	return nil
+}
+
+type RMSProp struct {
+	rho          float64
+	epsilon      float64
+	accumulators map[uintptr]*mat.Dense
+}
+
+// NewRMSProp divides gradients by the root of the moving average of their
+// squares (Hinton, Neural Networks for Machine Learning, lecture 6e), so that
+// every parameter gets its own step size. The average decays by rho, and
+// epsilon keeps the division away from zero
+func NewRMSProp(rho, epsilon float64) Optimizer {
+	if err := validateOptimizer(rho, epsilon); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &RMSProp{
+		rho:          rho,
+		epsilon:      epsilon,
+		accumulators: make(map[uintptr]*mat.Dense),
+	}
+}
+
+func (r *RMSProp) Apply(weights, deltaWs *mat.Dense, lr float64) {
+	v := accumulator(r.accumulators, weights)
+
+	// v = rho*v + (1-rho)*g²
+	average(v, deltaWs, r.rho)
+
+	// w = w - lr*g/(√v+ε)
+	weights.Sub(weights, adaptive(deltaWs, v, lr, r.epsilon))
+}
+
+func (r *RMSProp) state(p *mat.Dense) []*mat.Dense {
+	if v, ok := r.accumulators[parameterKey(p)]; ok {
+		return []*mat.Dense{v}
+	}
+
+	return nil
+}
+
+func (r *RMSProp) setState(p *mat.Dense, state []*mat.Dense) error {
+	if err := checkState(p, state, 1); err != nil {
+		return err
+	}
+
+	r.accumulators[parameterKey(p)] = state[0]
+
+	return nil
+}
+
+type Adagrad struct {
+	epsilon      float64
+	accumulators map[uintptr]*mat.Dense
+}
+
+// NewAdagrad divides gradients by the root of the sum of all their squares
+// seen so far (Duchi et al., Adaptive Subgradient Methods for Online Learning
+// and Stochastic Optimization, 2011), so that frequently updated parameters
+// slow down. Epsilon keeps the division away from zero
+func NewAdagrad(epsilon float64) Optimizer {
+	if err := validateOptimizer(0, epsilon); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &Adagrad{
+		epsilon:      epsilon,
+		accumulators: make(map[uintptr]*mat.Dense),
+	}
+}
+
+func (a *Adagrad) Apply(weights, deltaWs *mat.Dense, lr float64) {
+	v := accumulator(a.accumulators, weights)
+
+	// v = v + g²
+	g2 := mat.DenseCopyOf(deltaWs)
+	g2.MulElem(g2, g2)
+	v.Add(v, g2)
+
+	// w = w - lr*g/(√v+ε)
+	weights.Sub(weights, adaptive(deltaWs, v, lr, a.epsilon))
+}
+
+func (a *Adagrad) state(p *mat.Dense) []*mat.Dense {
+	if v, ok := a.accumulators[parameterKey(p)]; ok {
+		return []*mat.Dense{v}
+	}
+
+	return nil
+}
+
+func (a *Adagrad) setState(p *mat.Dense, state []*mat.Dense) error {
+	if err := checkState(p, state, 1); err != nil {
+		return err
+	}
+
+	a.accumulators[parameterKey(p)] = state[0]
+
+	return nil
+}
+
+type Adadelta struct {
+	rho       float64
+	epsilon   float64
+	gradients map[uintptr]*mat.Dense
+	updates   map[uintptr]*mat.Dense
+}
+
+// NewAdadelta creates Adadelta (Zeiler, https://doi.org/10.48550/arXiv.1212.5701),
+// which scales gradients by the ratio of roots of moving averages of squared
+// updates and squared gradients, so that updates have the same units as
+// parameters. Updates are still scaled by the learning rate of the schedule, so
+// NewFlatLearningRate(1) must be used to match the paper
+func NewAdadelta(rho, epsilon float64) Optimizer {
+	if err := validateOptimizer(rho, epsilon); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &Adadelta{
+		rho:       rho,
+		epsilon:   epsilon,
+		gradients: make(map[uintptr]*mat.Dense),
+		updates:   make(map[uintptr]*mat.Dense),
+	}
+}
+
+func (a *Adadelta) Apply(weights, deltaWs *mat.Dense, lr float64) {
+	eg := accumulator(a.gradients, weights)
+	ex := accumulator(a.updates, weights)
+
+	// E[g²] = rho*E[g²] + (1-rho)*g²
+	average(eg, deltaWs, a.rho)
+
+	// Δx = √(E[Δx²]+ε)/√(E[g²]+ε) * g
+	update := mat.NewDense(eg.RawMatrix().Rows, eg.RawMatrix().Cols, nil)
+	update.Apply(func(i, j int, g float64) float64 {
+		return math.Sqrt(ex.At(i, j)+a.epsilon) / math.Sqrt(eg.At(i, j)+a.epsilon) * g
+	}, deltaWs)
+
+	// E[Δx²] = rho*E[Δx²] + (1-rho)*Δx²
+	average(ex, update, a.rho)
+
+	update.Scale(lr, update)
+	weights.Sub(weights, update)
+}
+
+func (a *Adadelta) state(p *mat.Dense) []*mat.Dense {
+	eg, ok := a.gradients[parameterKey(p)]
+	if !ok {
+		return nil
+	}
+
+	return []*mat.Dense{eg, a.updates[parameterKey(p)]}
+}
+
+func (a *Adadelta) setState(p *mat.Dense, state []*mat.Dense) error {
+	if err := checkState(p, state, 2); err != nil {
+		return err
+	}
+
+	a.gradients[parameterKey(p)] = state[0]
+	a.updates[parameterKey(p)] = state[1]
+
+	return nil
+}
+
+// parameterKey identifies a parameter by its memory, so that rows of a matrix
+// get their own state when they are updated one by one
+func parameterKey(p *mat.Dense) uintptr {
+	return uintptr(unsafe.Pointer(&p.RawMatrix().Data[0]))
+}
+
+// accumulator returns the state of a parameter, which starts from zeros
+func accumulator(accumulators map[uintptr]*mat.Dense, p *mat.Dense) *mat.Dense {
+	key := parameterKey(p)
+
+	if _, ok := accumulators[key]; !ok {
+		accumulators[key] = mat.NewDense(p.RawMatrix().Rows, p.RawMatrix().Cols, nil)
+	}
+
+	return accumulators[key]
+}
+
+// average updates the moving average of squares of m decaying by rho
+func average(avg, m *mat.Dense, rho float64) {
+	avg.Apply(func(i, j int, v float64) float64 {
+		return rho*v + (1-rho)*m.At(i, j)*m.At(i, j)
+	}, avg)
+}
+
+// adaptive returns the update lr*g/(√v+ε)
+func adaptive(g, v *mat.Dense, lr, epsilon float64) *mat.Dense {
+	update := mat.NewDense(g.RawMatrix().Rows, g.RawMatrix().Cols, nil)
+	update.Apply(func(i, j int, x float64) float64 {
+		return lr * x / (math.Sqrt(v.At(i, j)) + epsilon)
+	}, g)
+
+	return update
+}
+
+// checkState tells whether the state has the given number of matrices shaped
+// like the parameter
+func checkState(p *mat.Dense, state []*mat.Dense, matrices int) error {
+	if len(state) != matrices {
+		return fmt.Errorf("%d matrices of state expected, got %d", matrices, len(state))
+	}
+
+	rows, cols := p.Dims()
+
+	for _, m := range state {
+		if r, c := m.Dims(); r != rows || c != cols {
+			return fmt.Errorf("state of %dx%d expected for the parameter, got %dx%d", rows, cols, r, c)
+		}
+	}
+
+	return nil
+}
+
+func validateOptimizer(rho, epsilon float64) error {
+	if rho < 0 || rho >= 1 {
+		return fmt.Errorf("decay rate must be in range [0, 1)")
+	}
+
+	if epsilon <= 0 {
+		return fmt.Errorf("epsilon must be greater than zero")
+	}
+
+	return nil
+}
+
+// newOptimizerLike returns an optimizer with the same hyperparameters as o, but
+// without its state
+func newOptimizerLike(o Optimizer) (Optimizer, error) {
+	switch t := o.(type) {
+	case *SGD:
+		return NewSGD(t.momentum, t.nesterov), nil
+	case *RMSProp:
+		return NewRMSProp(t.rho, t.epsilon), nil
+	case *Adagrad:
+		return NewAdagrad(t.epsilon), nil
+	case *Adadelta:
+		return NewAdadelta(t.rho, t.epsilon), nil
+	}
+
+	return nil, fmt.Errorf("unsupported optimizer %T", o)
+}
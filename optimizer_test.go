@@ -0,0 +1,177 @@
+package deeper
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// optimizers returns an optimizer of every kind along with a learning rate
+// that suits it
+func optimizers() map[string]struct {
+	optimizer Optimizer
+	rate      float64
+} {
+	return map[string]struct {
+		optimizer Optimizer
+		rate      float64
+	}{
+		"SGD":      {NewSGD(0.9, true), 0.1},
+		"RMSProp":  {NewRMSProp(0.9, 1e-7), 0.01},
+		"Adagrad":  {NewAdagrad(1e-7), 0.01},
+		"Adadelta": {NewAdadelta(0.95, 1e-6), 1},
+	}
+}
+
+// tokenNetwork returns a network with an embedding and a recurrent layer, so
+// that optimizers keep state of both whole parameters and rows of them
+func tokenNetwork(o Optimizer) *Network {
+	n := NewNetwork()
+	n.AddLayer(NewInputLayer(1))
+	n.AddLayer(NewEmbedding(10, 4))
+	n.AddLayer(NewGRU(6, RecurrentOptions{}))
+	n.AddLayer(NewOutputLayer(2, NewSoftmax()))
+	n.SetOptimizer(o)
+	n.SetLossFunction(NewCategoricalCrossEntropy(ReductionMean))
+	n.SetVerbosity(VerbosityQuiet)
+	return n
+}
+
+func TestOptimizers(t *testing.T) {
+	x, y := tokenData(300)
+	for name, o := range optimizers() {
+		n := tokenNetwork(o.optimizer)
+		before := n.Evaluate(x, y).Loss
+		n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 3, BatchSize: 16, LearningRate: NewFlatLearningRate(o.rate)})
+		if after := n.Evaluate(x, y).Loss; after >= before {
+			t.Errorf("%s: loss grows from %v to %v", name, before, after)
+		}
+	}
+}
+
+func TestOptimizerCheckpoint(t *testing.T) {
+	x, y := tokenData(100)
+	for name, o := range optimizers() {
+		n := tokenNetwork(o.optimizer)
+		n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 1, BatchSize: 16, LearningRate: NewFlatLearningRate(o.rate)})
+		m, _ := checkpointRoundTrip(t, n, Checkpoint{Epoch: 1})
+
+		a, b := n.optimizer.(statefulOptimizer), m.optimizer.(statefulOptimizer)
+		pa, pb := n.parameters(), m.parameters()
+		states := 0
+		for i := range pa {
+			rows, cols := pa[i].Dims()
+			// -1 stands for the whole parameter
+			for row := -1; row < rows; row++ {
+				p, q := pa[i], pb[i]
+				if row >= 0 {
+					p, q = p.Slice(row, row+1, 0, cols).(*mat.Dense), q.Slice(row, row+1, 0, cols).(*mat.Dense)
+				}
+				sa, sb := a.state(p), b.state(q)
+				if len(sa) != len(sb) {
+					t.Fatalf("%s: parameter %d, row %d has %d matrices of state, loaded %d", name, i, row, len(sa), len(sb))
+				}
+				for k := range sa {
+					if !mat.Equal(sa[k], sb[k]) {
+						t.Fatalf("%s: state of parameter %d, row %d differs", name, i, row)
+					}
+				}
+				states += len(sa)
+			}
+		}
+		if states == 0 {
+			t.Fatalf("%s: no state is saved", name)
+		}
+
+		// both networks take the same step from here, up to the order of
+		// summing gradients of samples
+		m.SetLossFunction(NewCategoricalCrossEntropy(ReductionMean))
+		m.SetVerbosity(VerbosityQuiet)
+		for _, c := range []*Network{n, m} {
+			c.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 1, BatchSize: len(x), LearningRate: NewFlatLearningRate(o.rate)})
+		}
+		for i := range pa {
+			if !mat.EqualApprox(pa[i], pb[i], 1e-9) {
+				t.Fatalf("%s: parameter %d differs after a step", name, i)
+			}
+		}
+	}
+}
+
+func TestSGDVelocityStartsFromGradient(t *testing.T) {
+	w := mat.NewDense(1, 2, []float64{1, 1})
+	o := NewSGD(0.9, false)
+
+	// the first step is not scaled down by 1 - momentum
+	o.Apply(w, mat.NewDense(1, 2, []float64{0.5, -0.5}), 1)
+	if !mat.EqualApprox(w, mat.NewDense(1, 2, []float64{0.5, 1.5}), 1e-12) {
+		t.Fatalf("weights after the first step are %v", mat.Formatted(w))
+	}
+
+	// v = 0.9*v + 0.1*g
+	o.Apply(w, mat.NewDense(1, 2, []float64{1.5, -0.5}), 1)
+	if !mat.EqualApprox(w, mat.NewDense(1, 2, []float64{-0.1, 2}), 1e-12) {
+		t.Fatalf("weights after the second step are %v", mat.Formatted(w))
+	}
+}
+
+// plainSGD is an optimizer unknown to checkpoints
+type plainSGD struct{}
+
+func (plainSGD) Apply(weights, deltaWs *mat.Dense, lr float64) {
+	deltaWs.Scale(lr, deltaWs)
+	weights.Sub(weights, deltaWs)
+}
+
+func TestCheckpointOfUnknownOptimizer(t *testing.T) {
+	n := newLinearNet()
+	n.SetOptimizer(plainSGD{})
+
+	m := NewNetwork()
+	m.SetOptimizer(plainSGD{})
+	var buf bytes.Buffer
+	if err := NewCheckpointer().SaveCheckpoint(&buf, n, Checkpoint{Epoch: 2}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCheckpointer().LoadCheckpoint(m, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.optimizer.(plainSGD); !ok || c.Epoch != 2 {
+		t.Fatalf("loaded network has optimizer %T", m.optimizer)
+	}
+}
+
+func TestImportInvalidOptimizerState(t *testing.T) {
+	x, y := tokenData(20)
+	n := tokenNetwork(NewAdadelta(0.95, 1e-6))
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 1, BatchSize: 10, LearningRate: NewFlatLearningRate(1)})
+
+	for name, change := range map[string]func(o *jsonOptimizer){
+		"epsilon":   func(o *jsonOptimizer) { o.Epsilon = 0 },
+		"rho":       func(o *jsonOptimizer) { o.Rho = 1 },
+		"matrices":  func(o *jsonOptimizer) { o.States[0].Matrices = o.States[0].Matrices[:1] },
+		"nil":       func(o *jsonOptimizer) { o.States[0].Matrices[1] = nil },
+		"shape":     func(o *jsonOptimizer) { m := o.States[0].Matrices[0]; m.Rows, m.Cols = m.Cols, m.Rows },
+		"data":      func(o *jsonOptimizer) { o.States[0].Matrices[0].Data = o.States[0].Matrices[0].Data[1:] },
+		"parameter": func(o *jsonOptimizer) { o.States[0].Parameter = 100 },
+	} {
+		e := &Export{}
+		j, err := e.export(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Checkpoint = &jsonCheckpoint{Optimizer: exportOptimizer(n)}
+		change(j.Checkpoint.Optimizer)
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(j); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewCheckpointer().LoadCheckpoint(NewNetwork(), &buf); err == nil {
+			t.Errorf("checkpoint with invalid %s is loaded", name)
+		}
+	}
+}
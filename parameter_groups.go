@@ -0,0 +1,80 @@
+package deeper
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ParameterGroup sets hyperparameters of weights or biases of some layers,
+// which every optimizer honours
+type ParameterGroup struct {
+	// Layers of the group, or every layer if empty
+	Layers []BackpropagationLayer
+	// Weights and Biases choose parameters of layers in the group, or both
+	// of them if neither is set
+	Weights bool
+	Biases  bool
+	// LearningRate multiplies the learning rate of the group, 1 if zero, so
+	// parameters are kept untouched with Frozen rather than a zero multiplier
+	LearningRate float64
+	// Frozen excludes parameters of the group from training (e.g., pretrained
+	// layers), so that neither gradients nor weight decay change them
+	Frozen bool
+	// WeightDecay is the rate of decoupled weight decay (Loshchilov and
+	// Hutter, https://doi.org/10.48550/arXiv.1711.05101), which shrinks
+	// parameters by lr*WeightDecay of their value on every step apart from
+	// their gradient
+	WeightDecay float64
+}
+
+// AddParameterGroup adds a group of parameters with their own learning rate
+// multiplier and weight decay (e.g., a lower rate for pretrained layers, or
+// no decay for biases). When groups overlap, the group added last wins.
+// Parameters out of any group have neither multiplier nor decay
+func (n *Network) AddParameterGroup(g ParameterGroup) {
+	if g.LearningRate == 0 {
+		g.LearningRate = 1
+	}
+
+	if g.LearningRate < 0 || g.WeightDecay < 0 {
+		log.Fatalln(fmt.Errorf("learning rate multiplier and weight decay must not be negative"))
+	}
+
+	if !g.Weights && !g.Biases {
+		g.Weights, g.Biases = true, true
+	}
+
+	n.groups = append(n.groups, g)
+}
+
+// group returns the group of weights or biases of a layer
+func (n *Network) group(l BackpropagationLayer, biases bool) ParameterGroup {
+	g := ParameterGroup{LearningRate: 1}
+
+	for _, pg := range n.groups {
+		if (biases && pg.Biases || !biases && pg.Weights) && (len(pg.Layers) == 0 || slices.Contains(pg.Layers, l)) {
+			g = pg
+		}
+	}
+
+	return g
+}
+
+// apply decays a parameter, then passes its gradient to the optimizer. Decay
+// goes first, so that it is proportional to the parameter before the step
+func (n *Network) apply(p, delta *mat.Dense, lr float64, g ParameterGroup) {
+	if g.Frozen {
+		return
+	}
+
+	lr *= g.LearningRate
+
+	if g.WeightDecay > 0 {
+		p.Scale(1-lr*g.WeightDecay, p)
+	}
+
+	n.optimizer.Apply(p, delta, lr)
+}
@@ -0,0 +1,104 @@
+package deeper
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestParameterGroupResolution(t *testing.T) {
+	hidden := NewHiddenLayer(8, NewTanh())
+	n := newLinearNet(hidden)
+	n.AddParameterGroup(ParameterGroup{WeightDecay: 0.1})
+	n.AddParameterGroup(ParameterGroup{Biases: true})
+	n.AddParameterGroup(ParameterGroup{Layers: []BackpropagationLayer{hidden}, LearningRate: 0.5})
+
+	for _, c := range []struct {
+		layer       BackpropagationLayer
+		biases      bool
+		rate, decay float64
+	}{
+		{hidden, false, 0.5, 0},
+		{hidden, true, 0.5, 0},
+		{n.Layers[2], false, 1, 0.1},
+		{n.Layers[2], true, 1, 0},
+	} {
+		if g := n.group(c.layer, c.biases); g.LearningRate != c.rate || g.WeightDecay != c.decay {
+			t.Errorf("group of %T (biases: %v) is %+v", c.layer, c.biases, g)
+		}
+	}
+
+	// parameters out of any group
+	m := NewNetwork()
+	if g := m.group(hidden, false); g.LearningRate != 1 || g.WeightDecay != 0 {
+		t.Fatalf("default group is %+v", g)
+	}
+}
+
+func TestDecoupledWeightDecay(t *testing.T) {
+	n := newLinearNet()
+	n.SetOptimizer(NewRMSProp(0.9, 1e-7))
+	n.AddParameterGroup(ParameterGroup{Weights: true, WeightDecay: 0.5})
+
+	// zero inputs and targets have no gradient for weights, so only decay
+	// changes them
+	var x, y []*mat.Dense
+	for range 5 {
+		x = append(x, mat.NewDense(2, 1, nil))
+		y = append(y, mat.NewDense(2, 1, nil))
+	}
+	w := mat.DenseCopyOf(n.Layers[1].Weights())
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 2, BatchSize: 5, LearningRate: NewFlatLearningRate(0.1)})
+
+	w.Scale(math.Pow(1-0.1*0.5, 2), w)
+	if !mat.EqualApprox(w, n.Layers[1].Weights(), 1e-12) {
+		t.Fatalf("weights are %v, want %v", mat.Formatted(n.Layers[1].Weights()), mat.Formatted(w))
+	}
+}
+
+func TestFrozenParameterGroup(t *testing.T) {
+	hidden := NewHiddenLayer(8, NewTanh())
+	n := newLinearNet(hidden)
+	n.SetOptimizer(NewSGD(0.9, false))
+	n.AddParameterGroup(ParameterGroup{WeightDecay: 0.1})
+	n.AddParameterGroup(ParameterGroup{Layers: []BackpropagationLayer{hidden}, Frozen: true})
+
+	w, b := mat.DenseCopyOf(hidden.Weights()), mat.DenseCopyOf(hidden.Biases())
+	out := mat.DenseCopyOf(n.Layers[2].Weights())
+	x, y := regData(64)
+	n.Fit(FitOptions{TrainX: x, TrainY: y, ValX: x, ValY: y, Epochs: 2, BatchSize: 16, LearningRate: NewFlatLearningRate(0.1)})
+
+	if !mat.Equal(w, hidden.Weights()) || !mat.Equal(b, hidden.Biases()) {
+		t.Fatal("frozen layer is trained")
+	}
+	if mat.Equal(out, n.Layers[2].Weights()) {
+		t.Fatal("layer out of the frozen group is not trained")
+	}
+	if n.optimizer.(*SGD).state(hidden.Weights()) != nil {
+		t.Fatal("optimizer keeps state of frozen parameters")
+	}
+}
+
+func TestCopyOfParameterGroups(t *testing.T) {
+	hidden := NewHiddenLayer(8, NewTanh())
+	n := newLinearNet(hidden)
+	n.AddParameterGroup(ParameterGroup{Layers: []BackpropagationLayer{hidden}, LearningRate: 0.5})
+	// a group of a layer out of the network must not turn into a group of
+	// every layer
+	n.AddParameterGroup(ParameterGroup{Layers: []BackpropagationLayer{NewHiddenLayer(8, NewTanh())}, Frozen: true})
+
+	c, err := n.copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.groups) != 1 {
+		t.Fatalf("copy has %d groups", len(c.groups))
+	}
+	if g := c.group(c.Layers[1], false); g.LearningRate != 0.5 || g.Frozen {
+		t.Fatalf("group of the copied hidden layer is %+v", g)
+	}
+	if g := c.group(c.Layers[2], false); g.LearningRate != 1 || g.Frozen {
+		t.Fatalf("group of the copied output layer is %+v", g)
+	}
+}
@@ -0,0 +1,93 @@
+package deeper
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+type GlobalAveragePooling struct {
+	input  BackpropagationLayer
+	output BackpropagationLayer
+}
+
+// NewGlobalAveragePooling creates a layer that averages a sequence (a
+// dimensions x steps matrix) over its steps. This turns outputs of sequence
+// layers (i.e., MultiHeadAttention) into a single column accepted by fully
+// connected layers. The layer has no weights.
+func NewGlobalAveragePooling() BackpropagationLayer {
+	return &GlobalAveragePooling{}
+}
+
+func (l *GlobalAveragePooling) Rows() int {
+	return l.input.Rows()
+}
+
+func (l *GlobalAveragePooling) Cols() int {
+	return l.input.Rows()
+}
+
+func (l *GlobalAveragePooling) IsInput() bool {
+	return false
+}
+
+func (l *GlobalAveragePooling) IsOutput() bool {
+	return false
+}
+
+func (l *GlobalAveragePooling) Weights() *mat.Dense {
+	return nil
+}
+
+func (l *GlobalAveragePooling) Biases() *mat.Dense {
+	return nil
+}
+
+func (l *GlobalAveragePooling) SetWeights(_ *mat.Dense) {
+}
+
+func (l *GlobalAveragePooling) SetBiases(_ *mat.Dense) {
+}
+
+func (l *GlobalAveragePooling) SetInput(input BackpropagationLayer) {
+	l.input = input
+}
+
+func (l *GlobalAveragePooling) SetOutput(output BackpropagationLayer) {
+	l.output = output
+}
+
+// InitParameters does nothing, as there are no parameters to initialize
+func (l *GlobalAveragePooling) InitParameters(_ WeightInitializer) {
+}
+
+func (l *GlobalAveragePooling) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	_, steps := x.Dims()
+
+	y := rowSums(x)
+	y.Scale(1/float64(steps), y)
+
+	if activations != nil {
+		activations.Push(y)
+	}
+
+	if l.output != nil {
+		return l.output.Feedforward(y, activations)
+	}
+
+	return y
+}
+
+// Backpropagation spreads error evenly over all steps of the input sequence
+func (l *GlobalAveragePooling) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop()
+
+	d, steps := activations.Peek().Dims()
+	prev := mat.NewDense(d, steps, nil)
+
+	prev.Apply(func(i, _ int, _ float64) float64 {
+		return delta.At(i, 0) / float64(steps)
+	}, prev)
+
+	if l.input != nil {
+		l.input.Backpropagation(prev, activations, deltaWs, deltaBs)
+	}
+}
@@ -0,0 +1,504 @@
+package deeper
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// RecurrentOptions configures SimpleRNN, LSTM and GRU layers
+type RecurrentOptions struct {
+	// ReturnSequences makes a layer return its hidden states for every time
+	// step (a neurons x steps matrix) instead of the last hidden state only
+	ReturnSequences bool
+	// TruncateSteps limits backpropagation through time to chunks of this many
+	// steps counting from the end of a sequence. Errors are not passed across
+	// borders of these chunks. Zero means the whole sequence
+	TruncateSteps int
+}
+
+// recurrent holds everything SimpleRNN, LSTM and GRU have in common. A sequence
+// is passed between layers as a matrix with one column per time step. Weights
+// of all gates are packed into a single matrix of (gates * neurons) rows and
+// (inputs + neurons) columns, so that an input x and the previous hidden state
+// h are multiplied at once: z = W[x; h] + b
+type recurrent struct {
+	RecurrentOptions
+	rows    int
+	gates   int
+	input   BackpropagationLayer
+	output  BackpropagationLayer
+	weights *mat.Dense
+	biases  *mat.Dense
+}
+
+func (r *recurrent) Rows() int {
+	return r.rows
+}
+
+func (r *recurrent) Cols() int {
+	return r.input.Rows()
+}
+
+func (r *recurrent) IsInput() bool {
+	return false
+}
+
+func (r *recurrent) IsOutput() bool {
+	return false
+}
+
+func (r *recurrent) Weights() *mat.Dense {
+	return r.weights
+}
+
+func (r *recurrent) Biases() *mat.Dense {
+	return r.biases
+}
+
+func (r *recurrent) SetWeights(w *mat.Dense) {
+	r.weights = w
+}
+
+func (r *recurrent) SetBiases(b *mat.Dense) {
+	r.biases = b
+}
+
+func (r *recurrent) SetInput(input BackpropagationLayer) {
+	r.input = input
+}
+
+func (r *recurrent) SetOutput(output BackpropagationLayer) {
+	r.output = output
+}
+
+// InitParameters initializes packed weights and biases of all gates
+func (r *recurrent) InitParameters(wi WeightInitializer) {
+	r.weights = wi.InitWeights(r.gates*r.rows, r.input.Rows()+r.rows)
+	r.biases = wi.InitWeights(r.gates*r.rows, 1)
+}
+
+// affine computes W[x; h] + b for gates packed into rows [from, to)
+func (r *recurrent) affine(v *mat.Dense, from, to int) *mat.Dense {
+	_, cols := r.weights.Dims()
+
+	z := mat.NewDense(to-from, 1, nil)
+	z.Mul(r.weights.Slice(from, to, 0, cols), v)
+	z.Add(z, r.biases.Slice(from, to, 0, 1))
+
+	return z
+}
+
+// accumulate adds updates for gates packed into rows [from, to) computed from
+// their error dz and input v = [x; h]. It returns the error with respect to
+// the input, Wᵀ * dz
+func (r *recurrent) accumulate(dz, v, deltaW, deltaB *mat.Dense, from, to int) *mat.Dense {
+	_, cols := r.weights.Dims()
+
+	// dz * [x; h]ᵀ
+	tmp := mat.NewDense(to-from, cols, nil)
+	tmp.Mul(dz, v.T())
+
+	dw := deltaW.Slice(from, to, 0, cols).(*mat.Dense)
+	dw.Add(dw, tmp)
+
+	db := deltaB.Slice(from, to, 0, 1).(*mat.Dense)
+	db.Add(db, dz)
+
+	// Wᵀ * dz
+	dv := mat.NewDense(cols, 1, nil)
+	dv.Mul(r.weights.Slice(from, to, 0, cols).T(), dz)
+
+	return dv
+}
+
+// emit passes hidden states (a neurons x (steps + 1) matrix where the first
+// column is the initial state) to the next layer. Depending on options, it is
+// either the last hidden state or all of them
+func (r *recurrent) emit(states *mat.Dense, activations *Stack) *mat.Dense {
+	rows, cols := states.Dims()
+
+	var y *mat.Dense
+
+	if r.ReturnSequences {
+		y = mat.DenseCopyOf(states.Slice(0, rows, 1, cols))
+	} else {
+		y = mat.DenseCopyOf(states.Slice(0, rows, cols-1, cols))
+	}
+
+	if activations != nil {
+		activations.Push(y)
+	}
+
+	if r.output != nil {
+		return r.output.Feedforward(y, activations)
+	}
+
+	return y
+}
+
+// errors expands error coming from the next layer to a neurons x steps matrix
+func (r *recurrent) errors(delta *mat.Dense, steps int) *mat.Dense {
+	if r.ReturnSequences {
+		return delta
+	}
+
+	dh := mat.NewDense(r.rows, steps, nil)
+	dh.Slice(0, r.rows, steps-1, steps).(*mat.Dense).Copy(delta)
+
+	return dh
+}
+
+// truncated reports whether error must not be passed from step t to step t-1
+func (r *recurrent) truncated(t, steps int) bool {
+	return r.TruncateSteps > 0 && (steps-t+1)%r.TruncateSteps == 0
+}
+
+// propagate pushes updates to stacks and passes error with respect to the
+// input sequence (dx) to the previous layer
+func (r *recurrent) propagate(deltaW, deltaB, dx *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	// Last layers go first to the stack to be on its bottom after recursion
+	deltaWs.Push(deltaW)
+	deltaBs.Push(deltaB)
+
+	if r.input != nil {
+		r.input.Backpropagation(dx, activations, deltaWs, deltaBs)
+	}
+}
+
+// join stacks an input column x and a hidden state h into one column [x; h]
+func join(x, h mat.Matrix) *mat.Dense {
+	v := &mat.Dense{}
+	v.Stack(x, h)
+
+	return v
+}
+
+type SimpleRNN struct {
+	recurrent
+	activation Activation
+}
+
+// NewSimpleRNN creates a fully connected recurrent layer (Elman network), which
+// computes h(t) = activation(W[x(t); h(t-1)] + b) for every step of a sequence.
+// Tanh is the usual choice of activation function for this layer
+func NewSimpleRNN(neurons int, activation Activation, o RecurrentOptions) BackpropagationLayer {
+	return &SimpleRNN{
+		recurrent: recurrent{
+			RecurrentOptions: o,
+			rows:             neurons,
+			gates:            1,
+		},
+		activation: activation,
+	}
+}
+
+// Feedforward computes hidden states for every step of a sequence x (an inputs
+// x steps matrix). All of them are stored in the activations stack for
+// backpropagation through time.
+func (l *SimpleRNN) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	_, steps := x.Dims()
+	states := mat.NewDense(l.rows, steps+1, nil)
+
+	for t := 1; t <= steps; t++ {
+		v := join(x.ColView(t-1), states.ColView(t-1))
+		h := l.activation.Activation(l.affine(v, 0, l.rows))
+		states.Slice(0, l.rows, t, t+1).(*mat.Dense).Copy(h)
+	}
+
+	if activations != nil {
+		activations.Push(states)
+	}
+
+	return l.emit(states, activations)
+}
+
+// Backpropagation unrolls the layer through time going from the last step to
+// the first one. On every step, error consists of error of the next layer for
+// this step and error passed from the following step through W.
+func (l *SimpleRNN) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop() // Own output is a part of states below
+	states := activations.Pop()
+	x := activations.Peek()
+
+	inputs, steps := x.Dims()
+	rows, cols := l.weights.Dims()
+
+	deltaW := mat.NewDense(rows, cols, nil)
+	deltaB := mat.NewDense(rows, 1, nil)
+	dx := mat.NewDense(inputs, steps, nil)
+	dhs := l.errors(delta, steps)
+	dh := mat.NewDense(l.rows, 1, nil)
+
+	for t := steps; t >= 1; t-- {
+		dh.Add(dh, dhs.Slice(0, l.rows, t-1, t))
+
+		// dh ⊙ activation(z)'
+		dz := mat.NewDense(l.rows, 1, nil)
+		dz.MulElem(dh, l.activation.Derivative(mat.DenseCopyOf(states.Slice(0, l.rows, t, t+1))))
+
+		v := join(x.ColView(t-1), states.ColView(t-1))
+		dv := l.accumulate(dz, v, deltaW, deltaB, 0, l.rows)
+
+		dx.Slice(0, inputs, t-1, t).(*mat.Dense).Copy(dv.Slice(0, inputs, 0, 1))
+		dh = mat.DenseCopyOf(dv.Slice(inputs, inputs+l.rows, 0, 1))
+
+		if l.truncated(t, steps) {
+			// Nothing else comes from the next layer, so we can stop here
+			if !l.ReturnSequences {
+				break
+			}
+
+			dh.Zero()
+		}
+	}
+
+	l.propagate(deltaW, deltaB, dx, activations, deltaWs, deltaBs)
+}
+
+type LSTM struct {
+	recurrent
+}
+
+// NewLSTM creates a long short-term memory layer proposed by Hochreiter and
+// Schmidhuber (https://doi.org/10.1162/neco.1997.9.8.1735) with a forget gate.
+// Its packed weights hold input, forget, cell and output gates in this order.
+func NewLSTM(neurons int, o RecurrentOptions) BackpropagationLayer {
+	return &LSTM{
+		recurrent: recurrent{
+			RecurrentOptions: o,
+			rows:             neurons,
+			gates:            4,
+		},
+	}
+}
+
+// Feedforward computes the following for every step of a sequence x:
+//
+//	i = σ(Wi[x; h] + bi), f = σ(Wf[x; h] + bf)
+//	g = tanh(Wg[x; h] + bg), o = σ(Wo[x; h] + bo)
+//	c(t) = f ⊙ c(t-1) + i ⊙ g
+//	h(t) = o ⊙ tanh(c(t))
+//
+// Hidden states, cell states and gates are kept in a single matrix of 6 *
+// neurons rows (h, c, i, f, g, o) and steps + 1 columns in the activations
+// stack for backpropagation through time.
+func (l *LSTM) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	_, steps := x.Dims()
+	n := l.rows
+	cache := mat.NewDense(6*n, steps+1, nil)
+
+	for t := 1; t <= steps; t++ {
+		v := join(x.ColView(t-1), cache.Slice(0, n, t-1, t))
+		z := l.affine(v, 0, 4*n).RawMatrix().Data
+
+		for j := range n {
+			i := sigmoid(z[j])
+			f := sigmoid(z[n+j])
+			g := math.Tanh(z[2*n+j])
+			o := sigmoid(z[3*n+j])
+			c := f*cache.At(n+j, t-1) + i*g
+
+			cache.Set(j, t, o*math.Tanh(c))
+			cache.Set(n+j, t, c)
+			cache.Set(2*n+j, t, i)
+			cache.Set(3*n+j, t, f)
+			cache.Set(4*n+j, t, g)
+			cache.Set(5*n+j, t, o)
+		}
+	}
+
+	if activations != nil {
+		activations.Push(cache)
+	}
+
+	return l.emit(cache.Slice(0, n, 0, steps+1).(*mat.Dense), activations)
+}
+
+// Backpropagation unrolls the layer through time. Both hidden and cell states
+// carry error from the following step to the previous one.
+func (l *LSTM) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop() // Own output is a part of the cache below
+	cache := activations.Pop()
+	x := activations.Peek()
+
+	inputs, steps := x.Dims()
+	rows, cols := l.weights.Dims()
+	n := l.rows
+
+	deltaW := mat.NewDense(rows, cols, nil)
+	deltaB := mat.NewDense(rows, 1, nil)
+	dx := mat.NewDense(inputs, steps, nil)
+	dhs := l.errors(delta, steps)
+	dh := make([]float64, n)
+	dc := make([]float64, n)
+
+	for t := steps; t >= 1; t-- {
+		dz := mat.NewDense(4*n, 1, nil)
+
+		for j := range n {
+			c := cache.At(n+j, t)
+			i := cache.At(2*n+j, t)
+			f := cache.At(3*n+j, t)
+			g := cache.At(4*n+j, t)
+			o := cache.At(5*n+j, t)
+			tc := math.Tanh(c)
+
+			dh[j] += dhs.At(j, t-1)
+			dc[j] += dh[j] * o * (1 - tc*tc)
+
+			dz.Set(j, 0, dc[j]*g*i*(1-i))
+			dz.Set(n+j, 0, dc[j]*cache.At(n+j, t-1)*f*(1-f))
+			dz.Set(2*n+j, 0, dc[j]*i*(1-g*g))
+			dz.Set(3*n+j, 0, dh[j]*tc*o*(1-o))
+
+			dc[j] *= f
+		}
+
+		v := join(x.ColView(t-1), cache.Slice(0, n, t-1, t))
+		dv := l.accumulate(dz, v, deltaW, deltaB, 0, 4*n)
+
+		dx.Slice(0, inputs, t-1, t).(*mat.Dense).Copy(dv.Slice(0, inputs, 0, 1))
+		copy(dh, dv.RawMatrix().Data[inputs:])
+
+		if l.truncated(t, steps) {
+			if !l.ReturnSequences {
+				break
+			}
+
+			clear(dh)
+			clear(dc)
+		}
+	}
+
+	l.propagate(deltaW, deltaB, dx, activations, deltaWs, deltaBs)
+}
+
+type GRU struct {
+	recurrent
+}
+
+// NewGRU creates a gated recurrent unit layer proposed by Cho et al.
+// (https://doi.org/10.48550/arXiv.1406.1078), where the reset gate is applied
+// before multiplication by recurrent weights. Its packed weights hold update,
+// reset and candidate gates in this order.
+func NewGRU(neurons int, o RecurrentOptions) BackpropagationLayer {
+	return &GRU{
+		recurrent: recurrent{
+			RecurrentOptions: o,
+			rows:             neurons,
+			gates:            3,
+		},
+	}
+}
+
+// Feedforward computes the following for every step of a sequence x:
+//
+//	z = σ(Wz[x; h(t-1)] + bz), r = σ(Wr[x; h(t-1)] + br)
+//	n = tanh(Wn[x; r ⊙ h(t-1)] + bn)
+//	h(t) = (1 - z) ⊙ n + z ⊙ h(t-1)
+//
+// Hidden states and gates are kept in a single matrix of 4 * neurons rows (h,
+// z, r, n) and steps + 1 columns in the activations stack for backpropagation
+// through time.
+func (l *GRU) Feedforward(x *mat.Dense, activations *Stack) *mat.Dense {
+	_, steps := x.Dims()
+	n := l.rows
+	cache := mat.NewDense(4*n, steps+1, nil)
+
+	for t := 1; t <= steps; t++ {
+		prev := cache.Slice(0, n, t-1, t)
+		zr := l.affine(join(x.ColView(t-1), prev), 0, 2*n).RawMatrix().Data
+		rh := mat.NewDense(n, 1, nil)
+
+		for j := range n {
+			cache.Set(n+j, t, sigmoid(zr[j]))
+			cache.Set(2*n+j, t, sigmoid(zr[n+j]))
+			rh.Set(j, 0, cache.At(2*n+j, t)*prev.At(j, 0))
+		}
+
+		c := l.affine(join(x.ColView(t-1), rh), 2*n, 3*n).RawMatrix().Data
+
+		for j := range n {
+			z := cache.At(n+j, t)
+			candidate := math.Tanh(c[j])
+
+			cache.Set(j, t, (1-z)*candidate+z*prev.At(j, 0))
+			cache.Set(3*n+j, t, candidate)
+		}
+	}
+
+	if activations != nil {
+		activations.Push(cache)
+	}
+
+	return l.emit(cache.Slice(0, n, 0, steps+1).(*mat.Dense), activations)
+}
+
+// Backpropagation unrolls the layer through time. The previous hidden state
+// receives error from three places: directly through the update gate, through
+// the reset gate, and through weights of the update and reset gates.
+func (l *GRU) Backpropagation(delta *mat.Dense, activations, deltaWs, deltaBs *Stack) {
+	activations.Pop() // Own output is a part of the cache below
+	cache := activations.Pop()
+	x := activations.Peek()
+
+	inputs, steps := x.Dims()
+	rows, cols := l.weights.Dims()
+	n := l.rows
+
+	deltaW := mat.NewDense(rows, cols, nil)
+	deltaB := mat.NewDense(rows, 1, nil)
+	dx := mat.NewDense(inputs, steps, nil)
+	dhs := l.errors(delta, steps)
+	dh := make([]float64, n)
+
+	for t := steps; t >= 1; t-- {
+		prev := cache.Slice(0, n, t-1, t)
+		dzr := mat.NewDense(2*n, 1, nil)
+		dc := mat.NewDense(n, 1, nil)
+		rh := mat.NewDense(n, 1, nil)
+
+		for j := range n {
+			z := cache.At(n+j, t)
+			candidate := cache.At(3*n+j, t)
+
+			dh[j] += dhs.At(j, t-1)
+			dc.Set(j, 0, dh[j]*(1-z)*(1-candidate*candidate))
+			dzr.Set(j, 0, dh[j]*(prev.At(j, 0)-candidate)*z*(1-z))
+			rh.Set(j, 0, cache.At(2*n+j, t)*prev.At(j, 0))
+
+			// Error passed to the previous step directly
+			dh[j] *= z
+		}
+
+		dvc := l.accumulate(dc, join(x.ColView(t-1), rh), deltaW, deltaB, 2*n, 3*n)
+
+		for j := range n {
+			r := cache.At(2*n+j, t)
+			drh := dvc.At(inputs+j, 0)
+
+			dzr.Set(n+j, 0, drh*prev.At(j, 0)*r*(1-r))
+			dh[j] += drh * r
+		}
+
+		dv := l.accumulate(dzr, join(x.ColView(t-1), prev), deltaW, deltaB, 0, 2*n)
+
+		dxt := dx.Slice(0, inputs, t-1, t).(*mat.Dense)
+		dxt.Add(dvc.Slice(0, inputs, 0, 1), dv.Slice(0, inputs, 0, 1))
+
+		for j := range n {
+			dh[j] += dv.At(inputs+j, 0)
+		}
+
+		if l.truncated(t, steps) {
+			if !l.ReturnSequences {
+				break
+			}
+
+			clear(dh)
+		}
+	}
+
+	l.propagate(deltaW, deltaB, dx, activations, deltaWs, deltaBs)
+}
@@ -0,0 +1,138 @@
+package deeper
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+var recurrentLayers = map[string]func(o RecurrentOptions) BackpropagationLayer{
+	"SimpleRNN": func(o RecurrentOptions) BackpropagationLayer { return NewSimpleRNN(4, NewTanh(), o) },
+	"LSTM":      func(o RecurrentOptions) BackpropagationLayer { return NewLSTM(4, o) },
+	"GRU":       func(o RecurrentOptions) BackpropagationLayer { return NewGRU(4, o) },
+}
+
+func TestRecurrentGradients(t *testing.T) {
+	for name, layer := range recurrentLayers {
+		for _, seq := range []bool{false, true} {
+			n := NewNetwork()
+			n.AddLayer(NewInputLayer(3))
+			n.AddLayer(layer(RecurrentOptions{ReturnSequences: seq}))
+			n.AddLayer(NewGRU(3, RecurrentOptions{ReturnSequences: seq}))
+
+			y := rnd(2, 1)
+			if seq {
+				n.AddLayer(NewLSTM(2, RecurrentOptions{ReturnSequences: true}))
+				y = rnd(2, 5)
+			} else {
+				n.AddLayer(NewHiddenLayer(5, NewSigmoid()))
+				n.AddLayer(NewOutputLayer(2, identity{}))
+			}
+
+			for _, l := range n.trainable() {
+				l.Weights().Scale(0.5, l.Weights())
+			}
+
+			t.Run(fmt.Sprintf("%s/ReturnSequences=%v", name, seq), func(t *testing.T) {
+				gradCheck(t, n, rnd(3, 5), y)
+			})
+		}
+	}
+}
+
+// probe is an input layer keeping the error passed back to it
+type probe struct {
+	BackpropagationLayer
+	delta *mat.Dense
+}
+
+func (p *probe) Backpropagation(delta *mat.Dense, _, _, _ *Stack) {
+	p.delta = delta
+}
+
+// numericalGradients returns numerical gradients of the loss with respect to
+// weights and biases of all trainable layers, followed by the gradient with
+// respect to x
+func numericalGradients(n *Network, x, y *mat.Dense) [][]float64 {
+	loss := func() float64 { return n.loss.Loss(forwardOf(n, x), y) }
+
+	var g [][]float64
+	for _, l := range n.trainable() {
+		g = append(g, numericalGradient(l.Weights(), loss), numericalGradient(l.Biases(), loss))
+	}
+
+	return append(g, numericalGradient(x, loss))
+}
+
+// joinSteps joins gradients with respect to two sequences of three inputs and
+// three steps one after another
+func joinSteps(a, b []float64) []float64 {
+	j := &mat.Dense{}
+	j.Augment(mat.NewDense(3, 3, a), mat.NewDense(3, 3, b))
+	return j.RawMatrix().Data
+}
+
+// TestTruncatedRecurrentGradients splits sequences of six steps into two chunks
+// of three. Inputs of the first chunk are zero, as well as biases of the
+// recurrent layer, so that its state at the border is zero. Then gradients of
+// truncated backpropagation are the sum of gradients of both chunks passed
+// through the network on their own.
+func TestTruncatedRecurrentGradients(t *testing.T) {
+	for name, layer := range recurrentLayers {
+		for _, seq := range []bool{false, true} {
+			p := &probe{BackpropagationLayer: NewInputLayer(3)}
+			n := NewNetwork()
+			n.AddLayer(p)
+			n.AddLayer(layer(RecurrentOptions{ReturnSequences: seq, TruncateSteps: 3}))
+			n.trainable()[0].Biases().Zero()
+			n.loss = halfSquaredError{}
+
+			head, tail := mat.NewDense(3, 3, nil), rnd(3, 3)
+			x := &mat.Dense{}
+			x.Augment(head, tail)
+
+			var y *mat.Dense
+			var expected [][]float64
+
+			if seq {
+				y = rnd(4, 6)
+				expected = numericalGradients(n, head, mat.DenseCopyOf(y.Slice(0, 4, 0, 3)))
+				for i, g := range numericalGradients(n, tail, mat.DenseCopyOf(y.Slice(0, 4, 3, 6))) {
+					if i == len(expected)-1 {
+						expected[i] = joinSteps(expected[i], g)
+						continue
+					}
+					for j := range g {
+						expected[i][j] += g[j]
+					}
+				}
+			} else {
+				n.AddLayer(NewOutputLayer(2, identity{}))
+				y = rnd(2, 1)
+				// steps before the border get no error at all
+				expected = numericalGradients(n, tail, y)
+				expected[len(expected)-1] = joinSteps(make([]float64, 9), expected[len(expected)-1])
+			}
+
+			t.Run(fmt.Sprintf("%s/ReturnSequences=%v", name, seq), func(t *testing.T) {
+				dWs, dBs := deltasOf(n, x, y)
+
+				var actual [][]float64
+				for range n.trainable() {
+					actual = append(actual, dWs.Pop().RawMatrix().Data, dBs.Pop().RawMatrix().Data)
+				}
+				actual = append(actual, p.delta.RawMatrix().Data)
+
+				for i := range expected {
+					for j, v := range expected[i] {
+						if e := math.Abs(v - actual[i][j]); e > 1e-5 {
+							t.Fatalf("gradient %d of parameter %d differs by %g", j, i, e)
+						}
+					}
+				}
+			})
+		}
+	}
+}
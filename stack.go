@@ -4,35 +4,50 @@ import "gonum.org/v1/gonum/mat"
 
 type Stack struct {
 	next  int
-	size  int
 	stack []*mat.Dense
+	rows  [][]int
 }
 
+// NewStack creates a stack with initial capacity for size matrices. The stack
+// grows when layers push more than one matrix (i.e., recurrent layers keeping
+// their intermediate states for backpropagation through time)
 func NewStack(size int) *Stack {
 	return &Stack{
-		size:  size,
-		stack: make([]*mat.Dense, size),
+		stack: make([]*mat.Dense, 0, size),
+		rows:  make([][]int, 0, size),
 	}
 }
 
 func (a *Stack) Push(m *mat.Dense) {
-	if a.next+1 > a.size {
-		panic("stack overflow")
-	}
+	a.PushSparse(m, nil)
+}
 
-	a.stack[a.next] = m
+// PushSparse pushes updates for a subset of rows of a larger matrix (i.e.,
+// rows of an embedding table looked up for a single sample), where row i of
+// m is an update for row rows[i] of that matrix
+func (a *Stack) PushSparse(m *mat.Dense, rows []int) {
+	a.stack = append(a.stack[:a.next], m)
+	a.rows = append(a.rows[:a.next], rows)
 	a.next++
 }
 
 func (a *Stack) Pop() *mat.Dense {
+	m, _ := a.PopSparse()
+	return m
+}
+
+// PopSparse pops a matrix along with indexes of rows it was pushed with. The
+// indexes are nil for matrices pushed through Push
+func (a *Stack) PopSparse() (*mat.Dense, []int) {
 	if a.next-1 < 0 {
 		panic("stack underflow")
 	}
 
-	t := a.stack[a.next-1]
+	t, rows := a.stack[a.next-1], a.rows[a.next-1]
 	a.next--
 	a.stack = a.stack[:a.next]
-	return t
+	a.rows = a.rows[:a.next]
+	return t, rows
 }
 
 func (a *Stack) Peek() *mat.Dense {